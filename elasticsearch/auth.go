@@ -0,0 +1,72 @@
+package elasticsearch
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	api "github.com/elastic/go-elasticsearch/v7"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// configureAuthentication sets the credentials of the client configuration
+// from the provider settings. At most one authentication method may be used.
+func configureAuthentication(data *schema.ResourceData, config *api.Config) error {
+	username := data.Get("username").(string)
+	password := data.Get("password").(string)
+	apiKey := data.Get("api_key").(string)
+	bearerToken := data.Get("bearer_token").(string)
+	serviceToken := data.Get("service_token").(string)
+
+	var methods []string
+	if username != "" || password != "" {
+		methods = append(methods, "username/password")
+	}
+	if apiKey != "" {
+		methods = append(methods, "api_key")
+	}
+	if bearerToken != "" {
+		methods = append(methods, "bearer_token")
+	}
+	if serviceToken != "" {
+		methods = append(methods, "service_token")
+	}
+	if len(data.Get("aws").([]interface{})) > 0 {
+		methods = append(methods, "aws")
+	}
+
+	if len(methods) > 1 {
+		return fmt.Errorf("only one authentication method can be configured, got: %s", strings.Join(methods, ", "))
+	}
+
+	switch {
+	case apiKey != "":
+		config.APIKey = encodeAPIKey(apiKey)
+	case bearerToken != "":
+		setAuthorizationHeader(config, "Bearer "+bearerToken)
+	case serviceToken != "":
+		setAuthorizationHeader(config, "Bearer "+serviceToken)
+	default:
+		config.Username = username
+		config.Password = password
+	}
+
+	return nil
+}
+
+// encodeAPIKey accepts an API key either already encoded or as `id:api_key`
+// and returns the base64 encoded form expected by Elasticsearch.
+func encodeAPIKey(apiKey string) string {
+	if strings.Contains(apiKey, ":") {
+		return base64.StdEncoding.EncodeToString([]byte(apiKey))
+	}
+	return apiKey
+}
+
+func setAuthorizationHeader(config *api.Config, value string) {
+	if config.Header == nil {
+		config.Header = http.Header{}
+	}
+	config.Header.Set("Authorization", value)
+}
@@ -0,0 +1,155 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+var awsSchema = schema.Resource{
+	Schema: map[string]*schema.Schema{
+		"region": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Description: "The AWS region of the domain. Defaults to the region of the AWS profile or environment.",
+		},
+		"profile": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Description: "The AWS profile used to load credentials from the shared configuration files.",
+		},
+		"access_key": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			RequiredWith: []string{"aws.0.secret_key"},
+			Description:  "Static AWS access key ID.",
+		},
+		"secret_key": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Sensitive:    true,
+			RequiredWith: []string{"aws.0.access_key"},
+			Description:  "Static AWS secret access key.",
+		},
+		"session_token": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Sensitive:   true,
+			Description: "Session token of temporary static AWS credentials.",
+		},
+		"role_arn": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Description: "ARN of a role that is assumed to sign the requests.",
+		},
+		"role_session_name": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Description: "Session name used when assuming role_arn.",
+		},
+		"external_id": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Description: "External ID used when assuming role_arn.",
+		},
+		"service": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Default:     "es",
+			Description: "The service name used in the signature, `es` for Amazon Elasticsearch/OpenSearch Service domains.",
+		},
+	},
+}
+
+// newAWSSigningTransport signs every request with AWS Signature Version 4
+// when the aws block is configured.
+func newAWSSigningTransport(data *schema.ResourceData, next http.RoundTripper) (http.RoundTripper, error) {
+	blocks := data.Get("aws").([]interface{})
+	if len(blocks) == 0 || blocks[0] == nil {
+		return next, nil
+	}
+	settings := blocks[0].(map[string]interface{})
+
+	options := session.Options{
+		Profile:           settings["profile"].(string),
+		SharedConfigState: session.SharedConfigEnable,
+	}
+
+	if region := settings["region"].(string); region != "" {
+		options.Config.Region = aws.String(region)
+	}
+
+	if accessKey := settings["access_key"].(string); accessKey != "" {
+		options.Config.Credentials = credentials.NewStaticCredentials(
+			accessKey,
+			settings["secret_key"].(string),
+			settings["session_token"].(string),
+		)
+	}
+
+	awsSession, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %s", err)
+	}
+
+	region := aws.StringValue(awsSession.Config.Region)
+	if region == "" {
+		return nil, fmt.Errorf("no AWS region configured, set aws.region or AWS_REGION")
+	}
+
+	awsCredentials := awsSession.Config.Credentials
+	if roleARN := settings["role_arn"].(string); roleARN != "" {
+		awsCredentials = stscreds.NewCredentials(awsSession, roleARN, func(provider *stscreds.AssumeRoleProvider) {
+			provider.RoleSessionName = settings["role_session_name"].(string)
+			if externalID := settings["external_id"].(string); externalID != "" {
+				provider.ExternalID = aws.String(externalID)
+			}
+		})
+	}
+
+	return &awsSigningTransport{
+		next:    next,
+		signer:  v4.NewSigner(awsCredentials),
+		service: settings["service"].(string),
+		region:  region,
+	}, nil
+}
+
+// awsSigningTransport signs requests right before they are sent, so that no
+// header changes after the signature is computed.
+type awsSigningTransport struct {
+	next    http.RoundTripper
+	signer  *v4.Signer
+	service string
+	region  string
+}
+
+func (t *awsSigningTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body for signing: %s", err)
+		}
+	}
+
+	signed := request.Clone(request.Context())
+	signed.Header.Del("Authorization")
+
+	if _, err := t.signer.Sign(signed, bytes.NewReader(body), t.service, t.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %s", err)
+	}
+
+	return t.next.RoundTrip(signed)
+}
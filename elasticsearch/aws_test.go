@@ -0,0 +1,105 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestAWSSigningTransport(t *testing.T) {
+	var received *http.Request
+	var receivedBody []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	data := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"aws": []interface{}{
+			map[string]interface{}{
+				"region":     "eu-west-1",
+				"access_key": "AKIDEXAMPLE",
+				"secret_key": "secret",
+			},
+		},
+	})
+
+	transport, err := newAWSSigningTransport(data, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"cluster":["monitor"]}`
+	request, err := http.NewRequest(http.MethodPut, server.URL+"/_security/role/test", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.SetBasicAuth("elastic", "changeme")
+
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeHTTPResponse(response)
+
+	if string(receivedBody) != body {
+		t.Errorf("expected body %s, got %s", body, receivedBody)
+	}
+
+	authorization := received.Header.Get("Authorization")
+	date := received.Header.Get("X-Amz-Date")
+	if date == "" {
+		t.Fatal("X-Amz-Date header is missing")
+	}
+
+	signedAt, err := time.Parse("20060102T150405Z", date)
+	if err != nil {
+		t.Fatalf("invalid X-Amz-Date %s: %s", date, err)
+	}
+
+	scope := "Credential=AKIDEXAMPLE/" + signedAt.Format("20060102") + "/eu-west-1/es/aws4_request"
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") || !strings.Contains(authorization, scope) {
+		t.Fatalf("expected a signature with scope %s, got %s", scope, authorization)
+	}
+
+	// The signature is computed again from the request as it was received.
+	expected, err := http.NewRequest(received.Method, server.URL+received.URL.RequestURI(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range signedHeaders(authorization) {
+		if name != "host" {
+			expected.Header.Set(name, received.Header.Get(name))
+		}
+	}
+
+	signer := v4.NewSigner(credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", ""))
+	if _, err := signer.Sign(expected, bytes.NewReader(receivedBody), "es", "eu-west-1", signedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := expected.Header.Get("Authorization"); actual != authorization {
+		t.Errorf("expected signature %s, got %s", actual, authorization)
+	}
+}
+
+func signedHeaders(authorization string) []string {
+	for _, part := range strings.Split(authorization, ", ") {
+		if strings.HasPrefix(part, "SignedHeaders=") {
+			return strings.Split(strings.TrimPrefix(part, "SignedHeaders="), ";")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package elasticsearch
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+const (
+	usersCache = "users"
+	rolesCache = "roles"
+)
+
+// objectReader requests the objects of a kind by name, or all of them when
+// the name is empty. Objects that do not exist are missing from the result.
+type objectReader func(ctx context.Context, name string, headers map[string]string) (map[string]interface{}, diag.Diagnostics)
+
+// readCache serves the reads of resources from all objects of a kind, which
+// are requested once, so that a refresh does not send a request per resource.
+// Objects written by the provider are stale and are read one by one.
+type readCache struct {
+	mutex   sync.Mutex
+	entries map[string]map[string]*cacheEntry
+}
+
+// cacheEntry holds the objects of a kind that a user can read. Objects are
+// nil when requesting them failed.
+type cacheEntry struct {
+	mutex   sync.Mutex
+	fetched bool
+	objects map[string]interface{}
+	stale   map[string]bool
+}
+
+// entry returns the objects of a kind read as the user the requests are run
+// as, if any.
+func (c *readCache) entry(kind string, runAs string) *cacheEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]map[string]*cacheEntry{}
+	}
+
+	if c.entries[kind] == nil {
+		c.entries[kind] = map[string]*cacheEntry{}
+	}
+
+	entry, exists := c.entries[kind][runAs]
+	if !exists {
+		entry = &cacheEntry{stale: map[string]bool{}}
+		c.entries[kind][runAs] = entry
+	}
+
+	return entry
+}
+
+// read returns the object of a kind with a name, or nil when it does not
+// exist. All objects are requested with the batch headers and a single
+// object with the headers of its resource. When all objects cannot be
+// requested, for example because of missing privileges, each object is
+// requested by itself.
+func (c *readCache) read(ctx context.Context, kind string, name string, headers map[string]string, batchHeaders map[string]string, reader objectReader) (interface{}, diag.Diagnostics) {
+	entry := c.entry(kind, headers[runAsHeader])
+
+	entry.mutex.Lock()
+
+	if !entry.fetched {
+		entry.fetched = true
+
+		objects, diags := reader(ctx, "", batchHeaders)
+		if diags.HasError() {
+			log.Printf("[WARN] Failed to read all %s, reading them one by one: %s", kind, diags[0].Summary)
+		} else {
+			log.Printf("[DEBUG] Read %d %s", len(objects), kind)
+			entry.objects = objects
+		}
+	}
+
+	cached := entry.objects != nil && !entry.stale[name]
+	object := entry.objects[name]
+
+	entry.mutex.Unlock()
+
+	if cached {
+		return object, nil
+	}
+
+	objects, diags := reader(ctx, name, headers)
+	if diags.HasError() {
+		return nil, diags
+	}
+
+	return objects[name], nil
+}
+
+// invalidate marks an object that was written as stale.
+func (c *readCache) invalidate(kind string, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, entry := range c.entries[kind] {
+		entry.mutex.Lock()
+		entry.stale[name] = true
+		entry.mutex.Unlock()
+	}
+}
@@ -0,0 +1,223 @@
+package elasticsearch
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// fakeReader serves objects from a map and records the names it is asked
+// for, where an empty name is a request for all objects.
+type fakeReader struct {
+	mutex    sync.Mutex
+	objects  map[string]interface{}
+	failAll  bool
+	requests []string
+	runAs    []string
+	opaqueID []string
+}
+
+func (r *fakeReader) read(ctx context.Context, name string, headers map[string]string) (map[string]interface{}, diag.Diagnostics) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests = append(r.requests, name)
+	r.runAs = append(r.runAs, headers[runAsHeader])
+	r.opaqueID = append(r.opaqueID, headers[opaqueIDHeader])
+
+	if name == "" {
+		if r.failAll {
+			return nil, diag.Errorf("forbidden")
+		}
+
+		objects := map[string]interface{}{}
+		for key, value := range r.objects {
+			objects[key] = value
+		}
+		return objects, nil
+	}
+
+	objects := map[string]interface{}{}
+	if object, exists := r.objects[name]; exists {
+		objects[name] = object
+	}
+	return objects, nil
+}
+
+func (r *fakeReader) count(name string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := 0
+	for _, request := range r.requests {
+		if request == name {
+			count++
+		}
+	}
+	return count
+}
+
+func readObject(t *testing.T, cache *readCache, name string, headers map[string]string, reader *fakeReader) interface{} {
+	t.Helper()
+
+	object, diags := cache.read(context.Background(), usersCache, name, headers, headers, reader.read)
+	if diags.HasError() {
+		t.Fatalf("unexpected error: %s", diags[0].Summary)
+	}
+	return object
+}
+
+func TestReadCacheRequestsAllObjectsOnce(t *testing.T) {
+	var cache readCache
+	reader := &fakeReader{objects: map[string]interface{}{"alice": 1, "bob": 2}}
+
+	if object := readObject(t, &cache, "alice", nil, reader); object != 1 {
+		t.Errorf("expected 1, got %v", object)
+	}
+	if object := readObject(t, &cache, "bob", nil, reader); object != 2 {
+		t.Errorf("expected 2, got %v", object)
+	}
+	if object := readObject(t, &cache, "carol", nil, reader); object != nil {
+		t.Errorf("expected a missing object, got %v", object)
+	}
+
+	if len(reader.requests) != 1 || reader.requests[0] != "" {
+		t.Errorf("expected a single request for all objects, got %q", reader.requests)
+	}
+}
+
+func TestReadCacheReadsStaleObjects(t *testing.T) {
+	var cache readCache
+	reader := &fakeReader{objects: map[string]interface{}{"alice": 1, "bob": 2}}
+
+	readObject(t, &cache, "alice", nil, reader)
+
+	reader.objects["alice"] = 3
+	cache.invalidate(usersCache, "alice")
+	cache.invalidate(rolesCache, "bob")
+
+	if object := readObject(t, &cache, "alice", nil, reader); object != 3 {
+		t.Errorf("expected the stale object to be read again, got %v", object)
+	}
+	if object := readObject(t, &cache, "bob", nil, reader); object != 2 {
+		t.Errorf("expected the cached object, got %v", object)
+	}
+
+	if count := reader.count("alice"); count != 1 {
+		t.Errorf("expected 1 request for the stale object, got %d", count)
+	}
+	if count := reader.count("bob"); count != 0 {
+		t.Errorf("expected no request for an object of another kind, got %d", count)
+	}
+	if count := reader.count(""); count != 1 {
+		t.Errorf("expected all objects to be requested once, got %d", count)
+	}
+}
+
+func TestReadCacheFallsBackToSingleReads(t *testing.T) {
+	var cache readCache
+	reader := &fakeReader{objects: map[string]interface{}{"alice": 1}, failAll: true}
+
+	if object := readObject(t, &cache, "alice", nil, reader); object != 1 {
+		t.Errorf("expected 1, got %v", object)
+	}
+	if object := readObject(t, &cache, "bob", nil, reader); object != nil {
+		t.Errorf("expected a missing object, got %v", object)
+	}
+	readObject(t, &cache, "alice", nil, reader)
+
+	if count := reader.count(""); count != 1 {
+		t.Errorf("expected all objects to be requested once, got %d", count)
+	}
+	if count := reader.count("alice"); count != 2 {
+		t.Errorf("expected 2 requests for the object, got %d", count)
+	}
+}
+
+func TestReadCacheSeparatesRunAsUsers(t *testing.T) {
+	var cache readCache
+	reader := &fakeReader{objects: map[string]interface{}{"alice": 1}}
+
+	readObject(t, &cache, "alice", nil, reader)
+	readObject(t, &cache, "alice", map[string]string{runAsHeader: "bob"}, reader)
+	readObject(t, &cache, "alice", map[string]string{runAsHeader: "bob"}, reader)
+
+	expected := []string{"", "bob"}
+	if len(reader.runAs) != len(expected) {
+		t.Fatalf("expected requests run as %q, got %q", expected, reader.runAs)
+	}
+	for i := range expected {
+		if reader.runAs[i] != expected[i] || reader.requests[i] != "" {
+			t.Errorf("expected all objects to be requested as %q, got %q as %q", expected[i], reader.requests[i], reader.runAs[i])
+		}
+	}
+
+	cache.invalidate(usersCache, "alice")
+	readObject(t, &cache, "alice", nil, reader)
+	readObject(t, &cache, "alice", map[string]string{runAsHeader: "bob"}, reader)
+
+	if count := reader.count("alice"); count != 2 {
+		t.Errorf("expected the object to be stale for every user, got %d requests", count)
+	}
+}
+
+func TestReadCacheConcurrentReads(t *testing.T) {
+	var cache readCache
+	reader := &fakeReader{objects: map[string]interface{}{"alice": 1, "bob": 2}}
+
+	var group sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+
+			name := "alice"
+			if i%2 == 0 {
+				name = "bob"
+			}
+			if i%10 == 0 {
+				cache.invalidate(usersCache, name)
+			}
+
+			object, diags := cache.read(context.Background(), usersCache, name, nil, nil, reader.read)
+			if diags.HasError() || object == nil {
+				t.Errorf("unexpected result %v: %v", object, diags)
+			}
+		}(i)
+	}
+	group.Wait()
+
+	if count := reader.count(""); count != 1 {
+		t.Errorf("expected all objects to be requested once, got %d", count)
+	}
+}
+
+func TestReadCacheBatchHeaders(t *testing.T) {
+	var cache readCache
+	reader := &fakeReader{objects: map[string]interface{}{"alice": 1}}
+	provider := &providerState{opaqueIDPrefix: "terraform"}
+
+	headers := map[string]string{
+		opaqueIDHeader: "terraform:elasticsearch_user.alice:read",
+		runAsHeader:    "bob",
+	}
+
+	read := func() {
+		if _, diags := cache.read(context.Background(), usersCache, "alice", headers, provider.batchHeaders(headers), reader.read); diags.HasError() {
+			t.Fatalf("unexpected error: %s", diags[0].Summary)
+		}
+	}
+
+	read()
+	cache.invalidate(usersCache, "alice")
+	read()
+
+	expected := []string{"terraform:refresh", "terraform:elasticsearch_user.alice:read"}
+	for i := range expected {
+		if reader.opaqueID[i] != expected[i] || reader.runAs[i] != "bob" {
+			t.Errorf("expected request %d with opaque ID %s run as bob, got %s run as %q", i, expected[i], reader.opaqueID[i], reader.runAs[i])
+		}
+	}
+}
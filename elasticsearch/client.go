@@ -0,0 +1,354 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+
+	api "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	flavorAuto          = "auto"
+	flavorElasticsearch = "elasticsearch"
+	flavorOpenSearch    = "opensearch"
+	flavorOSS           = "oss"
+)
+
+const (
+	runAsHeader    = "es-security-runas-user"
+	opaqueIDHeader = "X-Opaque-Id"
+)
+
+const (
+	operationCreate  = "create"
+	operationRead    = "read"
+	operationUpdate  = "update"
+	operationDelete  = "delete"
+	operationRefresh = "refresh"
+)
+
+// providerState is the configured provider shared by all resources.
+type providerState struct {
+	client         *api.Client
+	username       string
+	runAs          string
+	flavor         string
+	opaqueIDPrefix string
+
+	mutex      sync.Mutex
+	cluster    *clusterInfo
+	clusterErr error
+
+	cache readCache
+}
+
+// clusterInfo describes the cluster the provider talks to.
+type clusterInfo struct {
+	version version
+	flavor  string
+	license string
+}
+
+// requestHeaders returns the headers sent with the requests of a resource of
+// a type for an operation.
+func (p *providerState) requestHeaders(data *schema.ResourceData, resource string, operation string) map[string]string {
+	headers := map[string]string{}
+
+	if p.opaqueIDPrefix != "" {
+		headers[opaqueIDHeader] = fmt.Sprintf("%s:%s.%s:%s", p.opaqueIDPrefix, resource, resourceName(data), operation)
+	}
+
+	runAs := p.runAs
+	if value, ok := data.GetOk(runAsUserKey); ok {
+		runAs = value.(string)
+	}
+
+	if runAs != "" {
+		headers[runAsHeader] = runAs
+	}
+
+	return headers
+}
+
+// batchHeaders returns the headers of requests for all objects of a kind,
+// which are shared by the resources that are read, so only the user the
+// requests are run as is kept from the headers of a resource.
+func (p *providerState) batchHeaders(headers map[string]string) map[string]string {
+	batch := map[string]string{}
+
+	if p.opaqueIDPrefix != "" {
+		batch[opaqueIDHeader] = fmt.Sprintf("%s:%s", p.opaqueIDPrefix, operationRefresh)
+	}
+
+	if runAs, ok := headers[runAsHeader]; ok {
+		batch[runAsHeader] = runAs
+	}
+
+	return batch
+}
+
+// resourceName returns the ID of a resource, or its name while it is created.
+func resourceName(data *schema.ResourceData) string {
+	if id := data.Id(); id != "" {
+		return id
+	}
+
+	for _, key := range []string{nameKey, usernameKey} {
+		if name, ok := data.GetOk(key); ok {
+			return name.(string)
+		}
+	}
+
+	return ""
+}
+
+// clusterInfo returns the version, flavor and license of the cluster. They are
+// requested once, which is on first use when the connection is lazy. A failed
+// request is not repeated, so that resources do not each wait for a cluster
+// that cannot be reached.
+func (p *providerState) clusterInfo(ctx context.Context) (*clusterInfo, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.cluster != nil || p.clusterErr != nil {
+		return p.cluster, p.clusterErr
+	}
+
+	cluster, err := fetchClusterInfo(ctx, p.client)
+	if err != nil {
+		// Errors of a cancelled request are not remembered.
+		if ctx.Err() == nil {
+			p.clusterErr = err
+		}
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] Connected to Elasticsearch %s (flavor: %s, license: %s)", cluster.version, cluster.flavor, cluster.license)
+
+	p.cluster = cluster
+	return cluster, nil
+}
+
+func fetchClusterInfo(ctx context.Context, client *api.Client) (*clusterInfo, error) {
+	response, err := client.Info(client.Info.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(response)
+
+	if response.IsError() {
+		return nil, responseError(response, "Failed to read cluster information")
+	}
+
+	var info infoResponse
+	if err := json.NewDecoder(response.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+
+	clusterVersion, err := parseVersion(info.Version.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &clusterInfo{
+		version: clusterVersion,
+		flavor:  info.Version.BuildFlavor,
+	}
+
+	if info.Version.Distribution == flavorOpenSearch {
+		cluster.flavor = flavorOpenSearch
+	}
+
+	if cluster.flavor == flavorOSS || cluster.flavor == flavorOpenSearch {
+		return cluster, nil
+	}
+
+	response, err = client.License.Get(client.License.Get.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(response)
+
+	// The license cannot be read without the monitor privilege; features are
+	// then not checked against it.
+	if response.IsError() {
+		log.Printf("[WARN] Failed to read the cluster license: [%d] %s", response.StatusCode, response.String())
+		return cluster, nil
+	}
+
+	var license licenseResponse
+	if err := json.NewDecoder(response.Body).Decode(&license); err != nil {
+		return nil, err
+	}
+	cluster.license = license.License.Type
+
+	return cluster, nil
+}
+
+// isOpenSearch reports whether the cluster runs OpenSearch, either as
+// configured with the flavor setting or as detected from the cluster.
+func (p *providerState) isOpenSearch(ctx context.Context) (bool, error) {
+	return p.detectOpenSearch(ctx, p.clusterInfo)
+}
+
+// plannedOpenSearch is isOpenSearch for the checks made while planning.
+func (p *providerState) plannedOpenSearch(ctx context.Context) (bool, error) {
+	return p.detectOpenSearch(ctx, p.plannedClusterInfo)
+}
+
+func (p *providerState) detectOpenSearch(ctx context.Context, info func(context.Context) (*clusterInfo, error)) (bool, error) {
+	switch p.flavor {
+	case flavorOpenSearch:
+		return true, nil
+	case flavorElasticsearch:
+		return false, nil
+	}
+
+	cluster, err := info(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return cluster.flavor == flavorOpenSearch, nil
+}
+
+// plannedClusterInfo returns the cluster information for the checks made
+// while planning. With lazy connections the checks are skipped until a
+// request connected to the cluster, so that planning does not wait for a
+// cluster that may not exist yet.
+func (p *providerState) plannedClusterInfo(ctx context.Context) (*clusterInfo, error) {
+	if lazy, ok := p.client.Transport.(*lazyTransport); ok && !lazy.isConnected() {
+		return nil, errDeferredConnection
+	}
+	return p.clusterInfo(ctx)
+}
+
+// requireVersion fails when the cluster is older than the version that
+// introduced a feature. The check is skipped while a lazy connection has
+// not been made yet, and for OpenSearch, whose versions are numbered
+// independently.
+func (p *providerState) requireVersion(ctx context.Context, minimum version, feature string) error {
+	if p.flavor == flavorOpenSearch {
+		return nil
+	}
+
+	cluster, err := p.plannedClusterInfo(ctx)
+	if err != nil {
+		log.Printf("[WARN] Not checking whether the cluster supports %s: %s", feature, err)
+		return nil
+	}
+
+	if cluster.flavor == flavorOpenSearch {
+		return nil
+	}
+
+	if !cluster.version.atLeast(minimum) {
+		return fmt.Errorf("%s requires Elasticsearch %s or later, the cluster runs %s", feature, minimum, cluster.version)
+	}
+
+	return nil
+}
+
+// requireSecurity fails when the cluster does not provide the security APIs.
+func (p *providerState) requireSecurity(ctx context.Context) error {
+	// Managed services such as Amazon OpenSearch Service report the OSS build
+	// flavor although they provide security, so a configured flavor is trusted.
+	if p.flavor != "" && p.flavor != flavorAuto {
+		return nil
+	}
+
+	cluster, err := p.plannedClusterInfo(ctx)
+	if err != nil {
+		log.Printf("[WARN] Not checking whether the cluster supports security: %s", err)
+		return nil
+	}
+
+	if cluster.flavor == flavorOSS {
+		return fmt.Errorf("the OSS distribution of Elasticsearch %s does not provide security features", cluster.version)
+	}
+
+	return nil
+}
+
+// requireAPIKeys fails for OpenSearch, which has no API keys.
+func (p *providerState) requireAPIKeys(ctx context.Context) error {
+	openSearch, err := p.plannedOpenSearch(ctx)
+	if err != nil {
+		log.Printf("[WARN] Not checking whether the cluster supports API keys: %s", err)
+		return nil
+	}
+
+	if openSearch {
+		return fmt.Errorf("elasticsearch_api_key is not supported by OpenSearch, which has no API keys")
+	}
+
+	return nil
+}
+
+// licenseWarning warns when the license of the cluster does not include a
+// feature. Such features are accepted but have no effect.
+func (p *providerState) licenseWarning(ctx context.Context, feature string, licenses ...string) diag.Diagnostics {
+	cluster, err := p.clusterInfo(ctx)
+	if err != nil || cluster.license == "" {
+		return nil
+	}
+
+	for _, license := range licenses {
+		if cluster.license == license {
+			return nil
+		}
+	}
+
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  fmt.Sprintf("%s is not available with the %s license of the cluster", feature, cluster.license),
+		Detail:   "The setting is stored but has no effect until the cluster has a license that includes it.",
+	}}
+}
+
+// perform sends a request that the API of the client does not provide.
+func (p *providerState) perform(ctx context.Context, method string, path string, body interface{}, headers map[string]string) (*esapi.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		var buffer bytes.Buffer
+		if err := json.NewEncoder(&buffer).Encode(body); err != nil {
+			return nil, err
+		}
+		reader = &buffer
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := p.client.Perform(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &esapi.Response{
+		StatusCode: response.StatusCode,
+		Body:       response.Body,
+		Header:     response.Header,
+	}, nil
+}
@@ -0,0 +1,176 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	api "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/estransport"
+)
+
+// errDeferredConnection is returned by checks that are skipped because a
+// lazy connection has not been made yet.
+var errDeferredConnection = errors.New("the connection to the cluster is deferred until its first use")
+
+const (
+	healthPollInterval      = 5 * time.Second
+	maxHealthRequestTimeout = 30 * time.Second
+)
+
+// healthCheck makes the provider wait until the cluster reaches a status.
+type healthCheck struct {
+	status  string
+	timeout time.Duration
+}
+
+// checkConnection verifies that the cluster can be used and describes why it
+// cannot. Without a health check the cluster is only pinged.
+func checkConnection(ctx context.Context, transport estransport.Interface, health healthCheck) error {
+	if health.status != "" {
+		return waitForHealth(ctx, transport, health)
+	}
+
+	response, err := esapi.PingRequest{}.Do(ctx, transport)
+	if err != nil {
+		return fmt.Errorf("cannot connect to Elasticsearch%s: %s", describeAddresses(transport), err)
+	}
+
+	defer closeResponse(response)
+
+	if response.IsError() {
+		return fmt.Errorf("Elasticsearch%s rejected the connection: %s", describeAddresses(transport), response.String())
+	}
+
+	return nil
+}
+
+// waitForHealth polls the cluster health until the cluster reaches the
+// expected status. The cluster may not accept connections at first, e.g.
+// right after it was provisioned, so failed requests are retried as well.
+func waitForHealth(ctx context.Context, transport estransport.Interface, health healthCheck) error {
+	deadline := time.Now().Add(health.timeout)
+
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("Elasticsearch%s did not reach the %s status within %s", describeAddresses(transport), health.status, health.timeout)
+		}
+
+		if remaining > maxHealthRequestTimeout {
+			remaining = maxHealthRequestTimeout
+		}
+
+		request := esapi.ClusterHealthRequest{
+			WaitForStatus: health.status,
+			Timeout:       remaining,
+		}
+
+		response, err := request.Do(ctx, transport)
+		if err != nil {
+			log.Printf("[DEBUG] Waiting for Elasticsearch to become available: %s", err)
+		} else {
+			message := response.String()
+			response.Body.Close()
+
+			switch {
+			case !response.IsError():
+				return nil
+			case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+				return fmt.Errorf("Elasticsearch%s rejected the health request: %s", describeAddresses(transport), message)
+			default:
+				// The health API answers 408 when the status is not reached in time.
+				log.Printf("[DEBUG] Waiting for Elasticsearch to reach the %s status: %s", health.status, message)
+			}
+		}
+
+		interval := healthPollInterval
+		if remaining := time.Until(deadline); remaining < interval {
+			interval = remaining
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func describeAddresses(transport estransport.Interface) string {
+	client, ok := transport.(*estransport.Client)
+	if !ok {
+		return ""
+	}
+
+	var addresses []string
+	for _, url := range client.URLs() {
+		addresses = append(addresses, url.Redacted())
+	}
+	return fmt.Sprintf(" at %s", strings.Join(addresses, ", "))
+}
+
+// deferConnection makes the client check the connection on its first request
+// instead of when the provider is configured.
+func deferConnection(client *api.Client, health healthCheck) {
+	client.Transport = &lazyTransport{next: client.Transport, health: health}
+	client.API = esapi.New(client.Transport)
+}
+
+// lazyTransport pings the cluster before the first request is performed.
+// A failed check fails the later requests as well, instead of waiting for the
+// cluster again on each of them.
+type lazyTransport struct {
+	next   estransport.Interface
+	health healthCheck
+
+	mutex sync.Mutex
+	err   error
+	// connected is accessed atomically, so that it can be read while a
+	// connection is being made.
+	connected int32
+}
+
+// isConnected reports whether the connection was checked successfully.
+func (t *lazyTransport) isConnected() bool {
+	return atomic.LoadInt32(&t.connected) == 1
+}
+
+func (t *lazyTransport) Perform(request *http.Request) (*http.Response, error) {
+	if err := t.connect(request.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.Perform(request)
+}
+
+func (t *lazyTransport) connect(ctx context.Context) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.isConnected() {
+		return nil
+	}
+
+	if t.err != nil {
+		return t.err
+	}
+
+	if err := checkConnection(ctx, t.next, t.health); err != nil {
+		// A request that was cancelled or timed out says nothing about the
+		// cluster, so the next request tries again.
+		if ctx.Err() == nil {
+			t.err = err
+		}
+		return err
+	}
+
+	atomic.StoreInt32(&t.connected, 1)
+	return nil
+}
@@ -0,0 +1,210 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// errorResponse is the body of a failed request. Elasticsearch describes the
+// error as an object, or sometimes as a plain string, while OpenSearch uses a
+// message.
+type errorResponse struct {
+	Error   json.RawMessage `json:"error"`
+	Message string          `json:"message"`
+}
+
+type errorCause struct {
+	Type      string       `json:"type"`
+	Reason    string       `json:"reason"`
+	RootCause []errorCause `json:"root_cause"`
+	CausedBy  *errorCause  `json:"caused_by"`
+}
+
+func (c errorCause) String() string {
+	if c.Type == "" {
+		return c.Reason
+	}
+	return fmt.Sprintf("%s: %s", c.Type, c.Reason)
+}
+
+// errorLocator returns the path of the attribute an error reason refers to,
+// or nil when the reason cannot be traced to an attribute.
+type errorLocator func(reason string) cty.Path
+
+// closeResponse drains and closes the body of a response, so that the
+// connection can be reused.
+func closeResponse(response *esapi.Response) {
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+}
+
+// closeHTTPResponse drains and closes the body of a response that is discarded.
+func closeHTTPResponse(response *http.Response) {
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+}
+
+// responseError describes a failed response as an error, for requests that
+// are not made by a resource.
+func responseError(response *esapi.Response, summary string) error {
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("%s: [%d] %s", summary, response.StatusCode, err)
+	}
+
+	if cause, ok := decodeError(body); ok {
+		return fmt.Errorf("%s: [%d] %s", summary, response.StatusCode, cause)
+	}
+
+	return fmt.Errorf("%s: [%d] %s", summary, response.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// responseDiagnostics describes a failed response. The summary tells what
+// failed, the detail lists the causes reported by the cluster.
+func responseDiagnostics(response *esapi.Response, summary string, locate errorLocator) diag.Diagnostics {
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return diag.Errorf("%s: [%d] %s", summary, response.StatusCode, err)
+	}
+
+	cause, ok := decodeError(body)
+	if !ok {
+		return diag.Errorf("%s: [%d] %s", summary, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	diagnostic := diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("%s: [%d] %s", summary, response.StatusCode, cause),
+	}
+
+	var details []string
+	reasons := []string{cause.Reason}
+	for _, rootCause := range cause.RootCause {
+		if rootCause.Type != cause.Type || rootCause.Reason != cause.Reason {
+			details = append(details, fmt.Sprintf("Root cause: %s", rootCause))
+			reasons = append(reasons, rootCause.Reason)
+		}
+	}
+	for causedBy := cause.CausedBy; causedBy != nil; causedBy = causedBy.CausedBy {
+		details = append(details, fmt.Sprintf("Caused by: %s", *causedBy))
+		reasons = append(reasons, causedBy.Reason)
+	}
+	diagnostic.Detail = strings.Join(details, "\n")
+
+	if locate != nil {
+		for _, reason := range reasons {
+			if path := locate(reason); path != nil {
+				diagnostic.AttributePath = path
+				break
+			}
+		}
+	}
+
+	return diag.Diagnostics{diagnostic}
+}
+
+func decodeError(body []byte) (errorCause, bool) {
+	var response errorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return errorCause{}, false
+	}
+
+	if len(response.Error) > 0 {
+		var cause errorCause
+		if err := json.Unmarshal(response.Error, &cause); err == nil && cause.Reason != "" {
+			return cause, true
+		}
+
+		var reason string
+		if err := json.Unmarshal(response.Error, &reason); err == nil && reason != "" {
+			return errorCause{Reason: reason}, true
+		}
+	}
+
+	if response.Message != "" {
+		return errorCause{Reason: response.Message}, true
+	}
+
+	return errorCause{}, false
+}
+
+var (
+	unknownClusterPrivilege = regexp.MustCompile(`unknown cluster privilege \[([^\]]+)\]`)
+	unknownIndexPrivilege   = regexp.MustCompile(`unknown index privilege \[([^\]]+)\]`)
+	passwordTooShort        = regexp.MustCompile(`(?i)passwords? must be at least`)
+	invalidUsername         = regexp.MustCompile(`(?i)invalid username`)
+	invalidQuery            = regexp.MustCompile(`(?i)query|parsing_exception`)
+)
+
+// roleErrorLocator traces unknown privileges and invalid document level
+// security queries to the attributes of a role at the given path.
+func roleErrorLocator(path cty.Path, role roleModel) errorLocator {
+	return func(reason string) cty.Path {
+		if match := unknownClusterPrivilege.FindStringSubmatch(reason); match != nil {
+			for i, privilege := range role.Cluster {
+				if privilege == match[1] {
+					return path.GetAttr(clusterKey).IndexInt(i)
+				}
+			}
+			return path.GetAttr(clusterKey)
+		}
+
+		if match := unknownIndexPrivilege.FindStringSubmatch(reason); match != nil {
+			for i, index := range role.Indices {
+				for j, privilege := range index.Privileges {
+					if privilege == match[1] {
+						return path.GetAttr(indicesKey).IndexInt(i).GetAttr(privilegesKey).IndexInt(j)
+					}
+				}
+			}
+			return path.GetAttr(indicesKey)
+		}
+
+		if invalidQuery.MatchString(reason) {
+			var queries []int
+			for i, index := range role.Indices {
+				if index.Query != "" {
+					queries = append(queries, i)
+				}
+			}
+			if len(queries) == 1 {
+				return path.GetAttr(indicesKey).IndexInt(queries[0]).GetAttr(queryKey)
+			}
+		}
+
+		return nil
+	}
+}
+
+// roleDescriptorsErrorLocator traces errors to the role descriptors of an
+// API key, given in the order of the configuration.
+func roleDescriptorsErrorLocator(roles []roleModel) errorLocator {
+	return func(reason string) cty.Path {
+		for i, role := range roles {
+			if path := roleErrorLocator(cty.GetAttrPath(roleDescriptorsKey).IndexInt(i), role)(reason); path != nil {
+				return path
+			}
+		}
+		return nil
+	}
+}
+
+// userErrorLocator traces invalid usernames and passwords to their attributes.
+func userErrorLocator(reason string) cty.Path {
+	switch {
+	case passwordTooShort.MatchString(reason):
+		return cty.GetAttrPath(passwordKey)
+	case invalidUsername.MatchString(reason):
+		return cty.GetAttrPath(usernameKey)
+	}
+	return nil
+}
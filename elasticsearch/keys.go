@@ -14,11 +14,14 @@ const metadataKey = "metadata"
 const nameKey = "name"
 const namesKey = "names"
 const passwordKey = "password"
+const passwordHashKey = "password_hash"
+const passwordInitialOnlyKey = "password_initial_only"
 const privilegesKey = "privileges"
 const queryKey = "query"
 const resourcesKey = "resources"
 const roleDescriptorsKey = "role_descriptors"
 const rolesKey = "roles"
 const runAsKey = "run_as"
+const runAsUserKey = "run_as_user"
 const usernameKey = "username"
 const apiKeyKey = "api_key"
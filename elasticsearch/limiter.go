@@ -0,0 +1,62 @@
+package elasticsearch
+
+import (
+	"math"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// limitTransport bounds the number of requests in flight and the rate at
+// which they are sent. Every attempt of a request counts, retries included.
+// A request stays in flight until the response headers are received, as
+// resources send further requests before closing a response.
+type limitTransport struct {
+	next      http.RoundTripper
+	semaphore chan struct{}
+	limiter   *rate.Limiter
+}
+
+// newLimitTransport returns the transport unchanged when neither limit is set.
+func newLimitTransport(next http.RoundTripper, maxConcurrentRequests int, requestsPerSecond float64) http.RoundTripper {
+	if maxConcurrentRequests <= 0 && requestsPerSecond <= 0 {
+		return next
+	}
+
+	transport := &limitTransport{next: next}
+
+	if maxConcurrentRequests > 0 {
+		transport.semaphore = make(chan struct{}, maxConcurrentRequests)
+	}
+
+	if requestsPerSecond > 0 {
+		burst := int(math.Max(1, math.Ceil(requestsPerSecond)))
+		transport.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	}
+
+	return transport
+}
+
+func (t *limitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+
+	if t.limiter != nil {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.semaphore == nil {
+		return t.next.RoundTrip(request)
+	}
+
+	select {
+	case t.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	defer func() { <-t.semaphore }()
+
+	return t.next.RoundTrip(request)
+}
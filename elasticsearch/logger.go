@@ -0,0 +1,149 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const redacted = "<redacted>"
+
+// sensitiveKeys are the JSON keys whose values are never logged.
+var sensitiveKeys = map[string]bool{
+	"access_token":  true,
+	"api_key":       true,
+	"encoded":       true,
+	"hash":          true,
+	"password":      true,
+	"password_hash": true,
+	"refresh_token": true,
+	"token":         true,
+}
+
+// sensitiveHeaders are the HTTP headers whose values are never logged.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":              true,
+	"Cookie":                     true,
+	"Es-Secondary-Authorization": true,
+	"Proxy-Authorization":        true,
+	"Set-Cookie":                 true,
+	"X-Amz-Security-Token":       true,
+}
+
+// debugLogger logs every request sent to Elasticsearch, with secrets redacted.
+// It is only used when Terraform runs with TF_LOG=DEBUG or a more verbose level.
+type debugLogger struct{}
+
+func (l *debugLogger) LogRoundTrip(request *http.Request, response *http.Response, err error, start time.Time, duration time.Duration) error {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "[DEBUG] Elasticsearch request %s %s", request.Method, request.URL.RequestURI())
+	if err != nil {
+		fmt.Fprintf(&builder, " failed after %s: %s", duration, err)
+	} else {
+		fmt.Fprintf(&builder, " returned %d in %s", response.StatusCode, duration)
+	}
+
+	builder.WriteString("\nRequest headers:")
+	writeHeaders(&builder, request.Header)
+	builder.WriteString("\nRequest body: ")
+	writeBody(&builder, request.Body)
+
+	if err == nil {
+		builder.WriteString("\nResponse headers:")
+		writeHeaders(&builder, response.Header)
+		builder.WriteString("\nResponse body: ")
+		writeBody(&builder, response.Body)
+	}
+
+	log.Print(builder.String())
+	return nil
+}
+
+func (l *debugLogger) RequestBodyEnabled() bool {
+	return true
+}
+
+func (l *debugLogger) ResponseBodyEnabled() bool {
+	return true
+}
+
+func writeHeaders(builder *strings.Builder, header http.Header) {
+	var names []string
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			value = redacted
+		}
+		fmt.Fprintf(builder, "\n  %s: %s", name, value)
+	}
+}
+
+func writeBody(builder *strings.Builder, body io.ReadCloser) {
+	if body == nil || body == http.NoBody {
+		builder.WriteString("<empty>")
+		return
+	}
+
+	defer body.Close()
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		fmt.Fprintf(builder, "<unreadable: %s>", err)
+		return
+	}
+
+	builder.WriteString(redactBody(content))
+}
+
+// redactBody replaces the values of sensitive keys in a JSON document. Bodies
+// that are not JSON are not logged, as they cannot be redacted.
+func redactBody(content []byte) string {
+	if len(content) == 0 {
+		return "<empty>"
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return fmt.Sprintf("<%d bytes, not JSON>", len(content))
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(redactValue(document)); err != nil {
+		return fmt.Sprintf("<%d bytes, not JSON>", len(content))
+	}
+
+	return strings.TrimSpace(buffer.String())
+}
+
+func redactValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			if sensitiveKeys[key] {
+				typed[key] = redacted
+			} else {
+				typed[key] = redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = redactValue(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,74 @@
+package elasticsearch
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "password",
+			body:     `{"username":"bob","password":"secret"}`,
+			expected: `{"password":"<redacted>","username":"bob"}`,
+		},
+		{
+			name:     "password hash",
+			body:     `{"password_hash":"$2a$10$abc"}`,
+			expected: `{"password_hash":"<redacted>"}`,
+		},
+		{
+			name:     "API key",
+			body:     `{"id":"key-id","api_key":"secret","encoded":"a2V5LWlkOnNlY3JldA=="}`,
+			expected: `{"api_key":"<redacted>","encoded":"<redacted>","id":"key-id"}`,
+		},
+		{
+			name:     "tokens",
+			body:     `{"access_token":"access","refresh_token":"refresh","type":"Bearer"}`,
+			expected: `{"access_token":"<redacted>","refresh_token":"<redacted>","type":"Bearer"}`,
+		},
+		{
+			name:     "nested role descriptors",
+			body:     `{"name":"key","role_descriptors":{"role":{"metadata":{"password":"secret"},"run_as":["bob"]}},"users":[{"token":"secret"}]}`,
+			expected: `{"name":"key","role_descriptors":{"role":{"metadata":{"password":"<redacted>"},"run_as":["bob"]}},"users":[{"token":"<redacted>"}]}`,
+		},
+		{
+			name:     "not JSON",
+			body:     `password=secret`,
+			expected: `<15 bytes, not JSON>`,
+		},
+		{
+			name:     "empty",
+			body:     ``,
+			expected: `<empty>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := redactBody([]byte(test.body)); actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWriteHeadersRedactsCredentials(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Basic Ym9iOnNlY3JldA==")
+	header.Set("X-Amz-Security-Token", "session")
+	header.Set("Content-Type", "application/json")
+
+	var builder strings.Builder
+	writeHeaders(&builder, header)
+
+	expected := "\n  Authorization: <redacted>\n  Content-Type: application/json\n  X-Amz-Security-Token: <redacted>"
+	if actual := builder.String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
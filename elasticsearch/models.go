@@ -1,13 +1,19 @@
 package elasticsearch
 
 type userModel struct {
-	Username string            `json:"username"`
-	Password string            `json:"password"`
-	Email    string            `json:"email"`
-	Enabled  bool              `json:"enabled"`
-	FullName string            `json:"full_name"`
-	Roles    []string          `json:"roles"`
-	Metadata map[string]string `json:"metadata"`
+	Username     string            `json:"username"`
+	Password     string            `json:"password,omitempty"`
+	PasswordHash string            `json:"password_hash,omitempty"`
+	Email        string            `json:"email"`
+	Enabled      bool              `json:"enabled"`
+	FullName     string            `json:"full_name"`
+	Roles        []string          `json:"roles"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+type passwordModel struct {
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
 }
 
 type fieldSecurityModel struct {
@@ -40,15 +46,33 @@ type apiKeyModel struct {
 	Name           string               `json:"name"`
 	Expiration     string               `json:"expiration,omitempty"`
 	RoleDescriptor map[string]roleModel `json:"role_descriptors,omitempty"`
+	Metadata       map[string]string    `json:"metadata,omitempty"`
 }
 
 type apiKeyCreateResponse struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Expiration int64  `json:"expiration"`
-	APIKey     string `json:"api_key"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Expiration  int64             `json:"expiration"`
+	APIKey      string            `json:"api_key"`
+	Metadata    map[string]string `json:"metadata"`
+	Invalidated bool              `json:"invalidated"`
 }
 
 type apiKeyGetResponse struct {
 	APIKeys []apiKeyCreateResponse `json:"api_keys"`
 }
+
+type infoResponse struct {
+	Version struct {
+		Number       string `json:"number"`
+		BuildFlavor  string `json:"build_flavor"`
+		Distribution string `json:"distribution"`
+	} `json:"version"`
+}
+
+type licenseResponse struct {
+	License struct {
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	} `json:"license"`
+}
@@ -0,0 +1,221 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/elastic/go-elasticsearch/v7"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	grantTypePassword          = "password"
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeRefreshToken      = "refresh_token"
+)
+
+// tokenRefreshMargin is how long before it expires an access token is renewed.
+const tokenRefreshMargin = time.Minute
+
+var oauth2Schema = schema.Resource{
+	Schema: map[string]*schema.Schema{
+		"grant_type": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      grantTypePassword,
+			ValidateFunc: validation.StringInSlice([]string{grantTypePassword, grantTypeClientCredentials}, false),
+			Description: "`password` exchanges username and password for a token. " +
+				"`client_credentials` obtains a token for the user the provider authenticates as otherwise, e.g. with a client certificate.",
+		},
+	},
+}
+
+type tokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// configureOAuth2 makes the client authenticate with access tokens obtained
+// from the token API, when the oauth2 block is configured. Tokens are
+// requested by a separate client that uses the configured credentials.
+func configureOAuth2(data *schema.ResourceData, config *api.Config) error {
+	blocks := data.Get("oauth2").([]interface{})
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	grantType := grantTypePassword
+	if blocks[0] != nil {
+		grantType = blocks[0].(map[string]interface{})["grant_type"].(string)
+	}
+
+	source := &tokenSource{
+		grantType: grantType,
+	}
+
+	tokenConfig := *config
+	tokenConfig.DiscoverNodesOnStart = false
+	tokenConfig.DiscoverNodesInterval = 0
+
+	if grantType == grantTypePassword {
+		if config.Username == "" || config.Password == "" {
+			return fmt.Errorf("the password grant of oauth2 requires a username and a password")
+		}
+
+		source.username = config.Username
+		source.password = config.Password
+		tokenConfig.Username = ""
+		tokenConfig.Password = ""
+	}
+
+	client, err := api.NewClient(tokenConfig)
+	if err != nil {
+		return err
+	}
+	source.client = client
+
+	config.Username = ""
+	config.Password = ""
+	config.Transport = &tokenTransport{next: config.Transport, source: source}
+
+	return nil
+}
+
+// tokenSource obtains access tokens and renews them before they expire.
+type tokenSource struct {
+	client    *api.Client
+	grantType string
+	username  string
+	password  string
+
+	mutex        sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+func (s *tokenSource) token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiresAt.Add(-tokenRefreshMargin)) {
+		return s.accessToken, nil
+	}
+
+	if s.refreshToken != "" {
+		err := s.request(ctx, tokenRequest{GrantType: grantTypeRefreshToken, RefreshToken: s.refreshToken})
+		if err == nil {
+			return s.accessToken, nil
+		}
+		log.Printf("[DEBUG] Failed to refresh the access token, requesting a new one: %s", err)
+	}
+
+	err := s.request(ctx, tokenRequest{GrantType: s.grantType, Username: s.username, Password: s.password})
+	if err != nil {
+		return "", err
+	}
+
+	return s.accessToken, nil
+}
+
+// invalidate discards an access token the cluster no longer accepts.
+func (s *tokenSource) invalidate(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.accessToken == token {
+		s.accessToken = ""
+	}
+}
+
+func (s *tokenSource) request(ctx context.Context, body tokenRequest) error {
+	var buffer bytes.Buffer
+	if err := json.NewEncoder(&buffer).Encode(body); err != nil {
+		return err
+	}
+
+	response, err := s.client.Security.GetToken(&buffer, s.client.Security.GetToken.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to obtain an access token: %s", err)
+	}
+
+	defer closeResponse(response)
+
+	if response.IsError() {
+		return responseError(response, "Failed to obtain an access token")
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return err
+	}
+
+	s.accessToken = token.AccessToken
+	s.refreshToken = token.RefreshToken
+	s.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	log.Printf("[DEBUG] Obtained an access token with the %s grant, valid until %s", body.GrantType, s.expiresAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// tokenTransport authenticates requests with an access token. A request the
+// cluster rejects with 401 is sent once more with a new token, which covers
+// tokens that expire or are invalidated during long runs.
+type tokenTransport struct {
+	next   http.RoundTripper
+	source *tokenSource
+}
+
+func (t *tokenTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token, err := t.source.token(request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := t.next.RoundTrip(authorize(request, token))
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return response, nil
+	}
+
+	t.source.invalidate(token)
+	token, err = t.source.token(request.Context())
+	if err != nil {
+		return response, nil
+	}
+
+	retry := authorize(request, token)
+	if request.GetBody != nil {
+		if retry.Body, err = request.GetBody(); err != nil {
+			return response, nil
+		}
+	}
+
+	closeHTTPResponse(response)
+	return t.next.RoundTrip(retry)
+}
+
+func authorize(request *http.Request, token string) *http.Request {
+	authorized := request.Clone(request.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	return authorized
+}
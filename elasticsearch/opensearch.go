@@ -0,0 +1,197 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// OpenSearch manages users and roles through its security plugin, whose
+// API and documents differ from the security API of Elasticsearch.
+const openSearchSecurityPath = "/_plugins/_security/api"
+
+type openSearchUserModel struct {
+	Password      string            `json:"password,omitempty"`
+	Hash          string            `json:"hash,omitempty"`
+	BackendRoles  []string          `json:"backend_roles"`
+	SecurityRoles []string          `json:"opendistro_security_roles"`
+	Attributes    map[string]string `json:"attributes"`
+	Description   string            `json:"description,omitempty"`
+}
+
+type openSearchIndexPermissionModel struct {
+	IndexPatterns  []string `json:"index_patterns"`
+	DLS            string   `json:"dls,omitempty"`
+	FLS            []string `json:"fls,omitempty"`
+	AllowedActions []string `json:"allowed_actions"`
+}
+
+type openSearchRoleModel struct {
+	ClusterPermissions []string                         `json:"cluster_permissions"`
+	IndexPermissions   []openSearchIndexPermissionModel `json:"index_permissions"`
+}
+
+func openSearchUserPath(username string) string {
+	return fmt.Sprintf("%s/internalusers/%s", openSearchSecurityPath, url.PathEscape(username))
+}
+
+func openSearchRolePath(name string) string {
+	return fmt.Sprintf("%s/roles/%s", openSearchSecurityPath, url.PathEscape(name))
+}
+
+// toOpenSearchUser translates a user. Roles are mapped to security roles,
+// metadata to attributes and the full name to the description.
+func toOpenSearchUser(user userModel) (openSearchUserModel, error) {
+	if user.Email != "" {
+		return openSearchUserModel{}, fmt.Errorf("OpenSearch does not support the %s of users", emailKey)
+	}
+
+	if !user.Enabled {
+		return openSearchUserModel{}, fmt.Errorf("OpenSearch does not support disabling users")
+	}
+
+	return openSearchUserModel{
+		Password:      user.Password,
+		Hash:          user.PasswordHash,
+		BackendRoles:  []string{},
+		SecurityRoles: user.Roles,
+		Attributes:    user.Metadata,
+		Description:   user.FullName,
+	}, nil
+}
+
+func fromOpenSearchUser(username string, user openSearchUserModel) userModel {
+	return userModel{
+		Username: username,
+		Enabled:  true,
+		FullName: user.Description,
+		Roles:    user.SecurityRoles,
+		Metadata: user.Attributes,
+	}
+}
+
+// toOpenSearchRole translates a role. Index privileges are mapped to allowed
+// actions, the query to document level security and the granted fields to
+// field level security.
+func toOpenSearchRole(role roleModel) (openSearchRoleModel, error) {
+	if err := checkOpenSearchRole(role); err != nil {
+		return openSearchRoleModel{}, err
+	}
+
+	result := openSearchRoleModel{
+		ClusterPermissions: role.Cluster,
+		IndexPermissions:   []openSearchIndexPermissionModel{},
+	}
+
+	for _, index := range role.Indices {
+		result.IndexPermissions = append(result.IndexPermissions, openSearchIndexPermissionModel{
+			IndexPatterns:  index.Names,
+			DLS:            index.Query,
+			FLS:            index.FieldSecurity.Grant,
+			AllowedActions: index.Privileges,
+		})
+	}
+
+	return result, nil
+}
+
+// checkOpenSearchRole fails when a role uses features OpenSearch does not have.
+func checkOpenSearchRole(role roleModel) error {
+	if len(role.Applications) > 0 {
+		return fmt.Errorf("OpenSearch does not support %s in roles", applicationsKey)
+	}
+
+	if len(role.RunAs) > 0 {
+		return fmt.Errorf("OpenSearch does not support %s in roles", runAsKey)
+	}
+
+	if len(role.Metadata) > 0 {
+		return fmt.Errorf("OpenSearch does not support %s in roles", metadataKey)
+	}
+
+	for _, index := range role.Indices {
+		if index.AllowUnRestrictedIndices {
+			return fmt.Errorf("OpenSearch does not support %s in roles", allowUnRestrictedIndicesKey)
+		}
+	}
+
+	return nil
+}
+
+func fromOpenSearchRole(role openSearchRoleModel) roleModel {
+	result := roleModel{
+		Cluster: role.ClusterPermissions,
+	}
+
+	for _, permission := range role.IndexPermissions {
+		index := indexModel{
+			Names:      permission.IndexPatterns,
+			Privileges: permission.AllowedActions,
+			Query:      permission.DLS,
+		}
+		if len(permission.FLS) > 0 {
+			index.FieldSecurity = fieldSecurityModel{Grant: permission.FLS}
+		}
+		result.Indices = append(result.Indices, index)
+	}
+
+	return result
+}
+
+func (p *providerState) putOpenSearchUser(ctx context.Context, user userModel, headers map[string]string) (*esapi.Response, error) {
+	body, err := toOpenSearchUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Backend roles are not managed by the provider, and replacing the user
+	// would remove them.
+	body.BackendRoles, err = p.readOpenSearchBackendRoles(ctx, user.Username, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.perform(ctx, http.MethodPut, openSearchUserPath(user.Username), body, headers)
+}
+
+// readOpenSearchBackendRoles requests the backend roles of a user, which has
+// none when it does not exist yet.
+func (p *providerState) readOpenSearchBackendRoles(ctx context.Context, username string, headers map[string]string) ([]string, error) {
+	response, err := p.perform(ctx, http.MethodGet, openSearchUserPath(username), nil, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeResponse(response)
+
+	if response.StatusCode == http.StatusNotFound {
+		return []string{}, nil
+	}
+
+	if response.IsError() {
+		return nil, fmt.Errorf("failed to read the backend roles of user %s: %s", username, response.Status())
+	}
+
+	var users map[string]openSearchUserModel
+	if err := json.NewDecoder(response.Body).Decode(&users); err != nil {
+		return nil, err
+	}
+
+	if backendRoles := users[username].BackendRoles; backendRoles != nil {
+		return backendRoles, nil
+	}
+
+	return []string{}, nil
+}
+
+func (p *providerState) putOpenSearchRole(ctx context.Context, name string, role roleModel, headers map[string]string) (*esapi.Response, error) {
+	body, err := toOpenSearchRole(role)
+	if err != nil {
+		return nil, err
+	}
+	return p.perform(ctx, http.MethodPut, openSearchRolePath(name), body, headers)
+}
@@ -2,11 +2,20 @@ package elasticsearch
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	api "github.com/elastic/go-elasticsearch/v7"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/logging"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 // Provider -
@@ -14,9 +23,146 @@ func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"url": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_URL", nil),
+				ConflictsWith: []string{"urls", "cloud_id"},
+				Description:   "The URL of the cluster. A comma separated list of URLs is accepted as well.",
+			},
+			"urls": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				ConflictsWith: []string{"url", "cloud_id"},
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Description: "The URLs of the cluster nodes. Requests fail over to the next node when one is unreachable.",
+			},
+			"sniff": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ELASTICSEARCH_SNIFF", false),
+				Description: "Discover the nodes of the cluster when the provider starts.",
+			},
+			"sniff_interval": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_SNIFF_INTERVAL", nil),
+				ValidateFunc: validateDuration,
+				Description:  "Interval at which the nodes of the cluster are discovered again, e.g. `5m`. Disabled by default.",
+			},
+			"flavor": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_FLAVOR", flavorAuto),
+				ValidateFunc: validation.StringInSlice([]string{flavorAuto, flavorElasticsearch, flavorOpenSearch}, false),
+				Description:  "The product the cluster runs: `elasticsearch`, `opensearch` or `auto` to detect it. Setting it also skips the check for the security features, which managed services such as Amazon OpenSearch Service provide although they report the OSS build flavor.",
+			},
+			"run_as": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				DefaultFunc: schema.EnvDefaultFunc("ELASTICSEARCH_URL", nil),
+				DefaultFunc: schema.EnvDefaultFunc("ELASTICSEARCH_RUN_AS", nil),
+				Description: "The user the requests of all resources are run as, unless the resource sets run_as_user.",
+			},
+			"opaque_id_prefix": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ELASTICSEARCH_OPAQUE_ID_PREFIX", nil),
+				Description: "Enables the X-Opaque-Id header, which Elasticsearch includes in audit logs, slow logs and tasks. Requests of resources are tagged as `<prefix>:<resource type>.<id>:<operation>`, requests that read all users or roles during a refresh as `<prefix>:refresh` and other requests as `<prefix>:provider`.",
+			},
+			"headers": {
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Description: "HTTP headers sent with every request. Can also be set with ELASTICSEARCH_HEADERS as `Name=value` pairs separated by commas.",
+			},
+			"proxy_url": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_PROXY_URL", nil),
+				ValidateFunc: validation.IsURLWithScheme([]string{"http", "https", "socks5"}),
+				Description:  "URL of the proxy used to reach the cluster. Defaults to the HTTP_PROXY and HTTPS_PROXY environment variables.",
+			},
+			"request_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_REQUEST_TIMEOUT", nil),
+				ValidateFunc: validateDuration,
+				Description:  "Maximum time a single request may take, e.g. `30s`. Unlimited by default.",
+			},
+			"max_concurrent_requests": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_MAX_CONCURRENT_REQUESTS", 0),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Maximum number of requests sent to the cluster at the same time. Unlimited by default.",
+			},
+			"requests_per_second": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_REQUESTS_PER_SECOND", 0.0),
+				ValidateFunc: validation.FloatAtLeast(0),
+				Description:  "Maximum number of requests sent to the cluster per second. Unlimited by default.",
+			},
+			"lazy_connect": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ELASTICSEARCH_LAZY_CONNECT", false),
+				Description: "Connect to the cluster on first use instead of when the provider is configured, e.g. when the cluster is created in the same run. Checks of the features the cluster supports are skipped until then.",
+			},
+			"wait_for_status": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_WAIT_FOR_STATUS", nil),
+				ValidateFunc: validation.StringInSlice([]string{"green", "yellow"}, false),
+				Description:  "Wait until the cluster health reaches this status, `green` or `yellow`, before managing resources.",
+			},
+			"wait_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_WAIT_TIMEOUT", "5m"),
+				ValidateFunc: validateDuration,
+				Description:  "Maximum time to wait for the cluster health set by wait_for_status.",
+			},
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_MAX_RETRIES", 3),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Maximum number of times a failed request is retried. Requests that fail to reach a node are retried on the other nodes, so setting 0 to disable retries also disables failover between nodes.",
+			},
+			"retry_on_status": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeInt,
+					ValidateFunc: validation.IntBetween(400, 599),
+				},
+				Description: "HTTP status codes that cause a request to be retried. Defaults to 429, 502, 503 and 504. Requests that are not idempotent, such as creating an API key, are not retried.",
+			},
+			"retry_backoff_min": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_RETRY_BACKOFF_MIN", "100ms"),
+				ValidateFunc: validateDuration,
+				Description:  "Delay before the first retry. The delay doubles with every retry.",
+			},
+			"retry_backoff_max": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("ELASTICSEARCH_RETRY_BACKOFF_MAX", "10s"),
+				ValidateFunc: validateDuration,
+				Description:  "Maximum delay between two retries.",
+			},
+			"cloud_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_CLOUD_ID", nil),
+				ConflictsWith: []string{"url", "urls"},
+				ValidateFunc:  validateCloudID,
+				Description:   "The Cloud ID of an Elastic Cloud deployment, used instead of url.",
 			},
 			"username": {
 				Type:        schema.TypeString,
@@ -28,11 +174,101 @@ func Provider() *schema.Provider {
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("ELASTICSEARCH_PASSWORD", nil),
 			},
+			"api_key": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_API_KEY", nil),
+				ConflictsWith: []string{"username", "password", "bearer_token", "service_token", "aws", "oauth2"},
+				Description:   "API key used to authenticate, either base64 encoded or in the `id:api_key` form.",
+			},
+			"bearer_token": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_BEARER_TOKEN", nil),
+				ConflictsWith: []string{"username", "password", "api_key", "service_token", "aws", "oauth2"},
+				Description:   "OAuth2 access token used to authenticate.",
+			},
+			"service_token": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_SERVICE_TOKEN", nil),
+				ConflictsWith: []string{"username", "password", "api_key", "bearer_token", "aws", "oauth2"},
+				Description:   "Service account token used to authenticate.",
+			},
+			"aws": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				Elem:          &awsSchema,
+				ConflictsWith: []string{"username", "password", "api_key", "bearer_token", "service_token", "oauth2"},
+				Description:   "Signs requests with AWS Signature Version 4, for Amazon Elasticsearch/OpenSearch Service domains.",
+			},
+			"oauth2": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				Elem:          &oauth2Schema,
+				ConflictsWith: []string{"api_key", "bearer_token", "service_token", "aws"},
+				Description:   "Exchanges the credentials for short-lived access tokens, which are renewed when they expire.",
+			},
+			"ca_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_CA_FILE", nil),
+				ConflictsWith: []string{"ca_pem"},
+				Description:   "Path to a PEM-encoded certificate authority used to verify the cluster certificate.",
+			},
+			"ca_pem": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_CA_PEM", nil),
+				ConflictsWith: []string{"ca_file"},
+				Description:   "PEM-encoded certificate authority used to verify the cluster certificate.",
+			},
+			"client_cert_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_CLIENT_CERT_FILE", nil),
+				ConflictsWith: []string{"client_cert_pem"},
+				Description:   "Path to a PEM-encoded client certificate used for PKI authentication.",
+			},
+			"client_cert_pem": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_CLIENT_CERT_PEM", nil),
+				ConflictsWith: []string{"client_cert_file"},
+				Description:   "PEM-encoded client certificate used for PKI authentication.",
+			},
+			"client_key_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_CLIENT_KEY_FILE", nil),
+				ConflictsWith: []string{"client_key_pem"},
+				Description:   "Path to the PEM-encoded private key of the client certificate.",
+			},
+			"client_key_pem": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				DefaultFunc:   schema.EnvDefaultFunc("ELASTICSEARCH_CLIENT_KEY_PEM", nil),
+				ConflictsWith: []string{"client_key_file"},
+				Description:   "PEM-encoded private key of the client certificate.",
+			},
+			"insecure": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ELASTICSEARCH_INSECURE", false),
+				Description: "Disables verification of the cluster certificate. Only use this for testing.",
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
-			"elasticsearch_user":    resourceUser(),
-			"elasticsearch_role":    resourceRole(),
-			"elasticsearch_api_key": resourceAPIKey(),
+			"elasticsearch_user":                  resourceUser(),
+			"elasticsearch_role":                  resourceRole(),
+			"elasticsearch_api_key":               resourceAPIKey(),
+			"elasticsearch_builtin_user_password": resourceBuiltinUserPassword(),
 		},
 		DataSourcesMap:       map[string]*schema.Resource{},
 		ConfigureContextFunc: providerConfigure,
@@ -41,42 +277,174 @@ func Provider() *schema.Provider {
 
 func providerConfigure(context context.Context, data *schema.ResourceData) (interface{}, diag.Diagnostics) {
 
-	url := data.Get("url").(string)
-	username := data.Get("username").(string)
-	password := data.Get("password").(string)
+	urls := mapStringArray(data.Get("urls").([]interface{}))
+	cloudID := data.Get("cloud_id").(string)
+
+	if url := data.Get("url").(string); url != "" {
+		urls = append(urls, splitCommaSeparated(url)...)
+	}
 
 	var diags diag.Diagnostics
-	var client *api.Client
-	var err error
 
-	if (url != "") || (username != "") || (password != "") {
+	config := api.Config{
+		Addresses:            urls,
+		DiscoverNodesOnStart: data.Get("sniff").(bool),
+	}
+
+	if interval := data.Get("sniff_interval").(string); interval != "" {
+		config.DiscoverNodesInterval, _ = time.ParseDuration(interval)
+	}
 
-		config := api.Config{
-			Addresses: []string{
-				url,
-			},
-			Username: username,
-			Password: password,
+	if len(urls) > 0 && cloudID != "" {
+		return nil, diag.Errorf("Only one of url, urls and cloud_id can be set")
+	}
+
+	if cloudID != "" {
+		endpoint, err := decodeCloudID(cloudID)
+		if err != nil {
+			return nil, diag.Errorf("Invalid cloud_id: %s", err)
 		}
-		client, err = api.NewClient(config)
+		log.Printf("[DEBUG] Using Elastic Cloud endpoint %s", endpoint)
+		config.CloudID = cloudID
+	}
+
+	if err := configureRetries(data, &config); err != nil {
+		return nil, diag.FromErr(err)
+	}
 
-	} else {
-		client, err = api.NewDefaultClient()
+	if err := configureAuthentication(data, &config); err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	if err := configureHeaders(data, &config); err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	if logging.IsDebugOrHigher() {
+		config.Logger = &debugLogger{}
 	}
 
+	transport, err := newTransport(data)
 	if err != nil {
 		return nil, diag.FromErr(err)
 	}
+	config.Transport = transport
 
-	response, err := client.Ping()
+	if err := configureOAuth2(data, &config); err != nil {
+		return nil, diag.FromErr(err)
+	}
 
+	client, err := api.NewClient(config)
 	if err != nil {
 		return nil, diag.FromErr(err)
 	}
+	keepUnretriedResponses(client)
+
+	state := &providerState{
+		client:         client,
+		username:       data.Get("username").(string),
+		runAs:          data.Get("run_as").(string),
+		flavor:         data.Get("flavor").(string),
+		opaqueIDPrefix: data.Get("opaque_id_prefix").(string),
+	}
+
+	health := healthCheck{
+		status: data.Get("wait_for_status").(string),
+	}
+	health.timeout, _ = time.ParseDuration(data.Get("wait_timeout").(string))
+
+	if data.Get("lazy_connect").(bool) {
+		deferConnection(client, health)
+		return state, diags
+	}
+
+	if err := checkConnection(context, client.Transport, health); err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	if _, err := state.clusterInfo(context); err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Failed to detect the cluster version",
+			Detail:   fmt.Sprintf("Resources are not checked against the features of the cluster: %s", err),
+		})
+	}
+
+	return state, diags
+}
+
+// decodeCloudID returns the Elasticsearch endpoint encoded in an Elastic Cloud ID,
+// which has the form `<name>:<base64 of host$elasticsearch_id$kibana_id>`.
+func decodeCloudID(cloudID string) (string, error) {
+	parts := strings.SplitN(cloudID, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("expected the format <name>:<encoded endpoints>")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("endpoints are not valid base64: %s", err)
+	}
+
+	values := strings.Split(string(decoded), "$")
+	if len(values) < 2 || values[0] == "" || values[1] == "" {
+		return "", fmt.Errorf("decoded endpoints must contain a host and an Elasticsearch ID")
+	}
+
+	return fmt.Sprintf("https://%s.%s", values[1], values[0]), nil
+}
+
+func validateCloudID(value interface{}, key string) ([]string, []error) {
+	if _, err := decodeCloudID(value.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q is not a valid Cloud ID: %s", key, err)}
+	}
+	return nil, nil
+}
+
+// splitCommaSeparated splits a comma separated list, ignoring empty items.
+func splitCommaSeparated(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func validateDuration(value interface{}, key string) ([]string, []error) {
+	if _, err := time.ParseDuration(value.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q is not a valid duration: %s", key, err)}
+	}
+	return nil, nil
+}
+
+// configureHeaders adds the custom headers to every request. Headers are read
+// from ELASTICSEARCH_HEADERS when the headers setting is not used.
+func configureHeaders(data *schema.ResourceData, config *api.Config) error {
+	headers := mapStringMap(data.Get("headers").(map[string]interface{}))
+
+	if len(headers) == 0 {
+		for _, pair := range splitCommaSeparated(os.Getenv("ELASTICSEARCH_HEADERS")) {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+				return fmt.Errorf("invalid header %q in ELASTICSEARCH_HEADERS, expected Name=value", pair)
+			}
+			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if len(headers) == 0 {
+		return nil
+	}
+
+	if config.Header == nil {
+		config.Header = http.Header{}
+	}
 
-	if response.IsError() {
-		return nil, diag.Errorf("Error: %s", response.String())
+	for name, value := range headers {
+		config.Header.Set(name, value)
 	}
 
-	return client, diags
+	return nil
 }
@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"io"
-	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
 
-	api "github.com/elastic/go-elasticsearch/v7"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -17,12 +17,56 @@ func resourceAPIKey() *schema.Resource {
 		CreateContext: resourceAPIKeyCreate,
 		ReadContext:   resourceAPIKeyRead,
 		DeleteContext: resourceAPIKeyDelete,
+		CustomizeDiff: resourceAPIKeyCustomizeDiff,
 		Schema:        apiKeyResource.Schema,
+		// API keys cannot be updated, so there is no update timeout.
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(defaultTimeout),
+			Read:   schema.DefaultTimeout(defaultTimeout),
+			Delete: schema.DefaultTimeout(defaultTimeout),
+		},
 	}
 }
 
+func resourceAPIKeyCustomizeDiff(context context.Context, diff *schema.ResourceDiff, state interface{}) error {
+	provider := state.(*providerState)
+
+	if err := provider.requireSecurity(context); err != nil {
+		return err
+	}
+
+	if err := provider.requireAPIKeys(context); err != nil {
+		return err
+	}
+
+	if err := provider.requireVersion(context, apiKeysVersion, "API keys"); err != nil {
+		return err
+	}
+
+	if _, ok := diff.GetOk(metadataKey); ok {
+		if err := provider.requireVersion(context, apiKeyMetadataVersion, "API key metadata"); err != nil {
+			return err
+		}
+	}
+
+	for _, source := range diff.Get(roleDescriptorsKey).([]interface{}) {
+		roleSource := source.(map[string]interface{})
+		err := checkRoleFeatures(context, provider, roleSource[indicesKey].([]interface{}), roleSource[applicationsKey].([]interface{}))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func resourceAPIKeyCreate(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
+	provider := state.(*providerState)
+	client := provider.client
+
+	if err := provider.requireAPIKeys(context); err != nil {
+		return diag.FromErr(err)
+	}
 
 	model := apiKeyModel{
 		Name: data.Get(nameKey).(string),
@@ -32,11 +76,17 @@ func resourceAPIKeyCreate(context context.Context, data *schema.ResourceData, st
 		model.Expiration = expiration.(string)
 	}
 
+	if metadata, ok := data.GetOk(metadataKey); ok {
+		model.Metadata = mapStringMap(metadata.(map[string]interface{}))
+	}
+
+	var roles []roleModel
 	if rolesSource, ok := data.GetOk(roleDescriptorsKey); ok {
 		model.RoleDescriptor = map[string]roleModel{}
 		for _, source := range rolesSource.([]interface{}) {
 			name, role := mapRole(source)
 			model.RoleDescriptor[name] = role
+			roles = append(roles, role)
 		}
 	}
 
@@ -45,68 +95,69 @@ func resourceAPIKeyCreate(context context.Context, data *schema.ResourceData, st
 		return diag.FromErr(err)
 	}
 
-	response, err := client.Security.CreateAPIKey(&buffer)
+	headers := provider.requestHeaders(data, "elasticsearch_api_key", operationCreate)
+	response, err := client.Security.CreateAPIKey(&buffer,
+		client.Security.CreateAPIKey.WithContext(context),
+		client.Security.CreateAPIKey.WithHeader(headers),
+	)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	defer response.Body.Close()
+	defer closeResponse(response)
 
 	if response.IsError() {
-		return diag.Errorf("Failed to create API key: [%d] %s", response.StatusCode, response.String())
+		return responseDiagnostics(response, "Failed to create API key", roleDescriptorsErrorLocator(roles))
 	}
 
 	var apiKey apiKeyCreateResponse
-	json.NewDecoder(response.Body).Decode(&apiKey)
+	if err := json.NewDecoder(response.Body).Decode(&apiKey); err != nil {
+		return diag.FromErr(err)
+	}
 
 	data.SetId(apiKey.ID)
 	data.Set(apiKeyKey, apiKey.APIKey)
 	data.Set(nameKey, apiKey.Name)
 
-	var diags diag.Diagnostics
-
-	return diags
+	return roleLicenseWarnings(context, provider, roles)
 }
 
 func resourceAPIKeyRead(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
-
-	var diags diag.Diagnostics
-
-	apiKeyID := data.Id()
+	provider := state.(*providerState)
 
-	response, err := client.Security.GetAPIKey(client.Security.GetAPIKey.WithID(apiKeyID))
-
-	if err != nil {
+	if err := provider.requireAPIKeys(context); err != nil {
 		return diag.FromErr(err)
 	}
 
-	defer response.Body.Close()
-
-	if response.IsError() {
-		return diag.Errorf("Failed to read role: [%d] %s", response.StatusCode, response.String())
-	}
+	apiKeyID := data.Id()
+	headers := provider.requestHeaders(data, "elasticsearch_api_key", operationRead)
 
-	var getReponse apiKeyGetResponse
-	if err = json.NewDecoder(response.Body).Decode(&getReponse); err != nil {
-		return diag.FromErr(err)
+	apiKey, diags := provider.readAPIKey(context, apiKeyID, headers)
+	if diags.HasError() {
+		return diags
 	}
 
-	if len(getReponse.APIKeys) != 1 {
-		return diag.Errorf("API key not found")
+	if apiKey == nil || apiKey.Invalidated || isExpired(*apiKey) {
+		log.Printf("[WARN] API key %s not found, invalidated or expired, removing it from state", apiKeyID)
+		data.SetId("")
+		return nil
 	}
 
-	apiKey := getReponse.APIKeys[0]
-
 	data.SetId(apiKey.ID)
 	data.Set(apiKeyKey, apiKey.APIKey)
 	data.Set(nameKey, apiKey.Name)
+	data.Set(metadataKey, apiKey.Metadata)
 
 	return diags
 }
 
 func resourceAPIKeyDelete(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
+	provider := state.(*providerState)
+	client := provider.client
+
+	if err := provider.requireAPIKeys(context); err != nil {
+		return diag.FromErr(err)
+	}
 
 	var diags diag.Diagnostics
 
@@ -118,21 +169,68 @@ func resourceAPIKeyDelete(context context.Context, data *schema.ResourceData, st
 		return diag.FromErr(err)
 	}
 
-	response, err := client.Security.InvalidateAPIKey(&buffer)
+	headers := provider.requestHeaders(data, "elasticsearch_api_key", operationDelete)
+	response, err := client.Security.InvalidateAPIKey(&buffer,
+		client.Security.InvalidateAPIKey.WithContext(context),
+		client.Security.InvalidateAPIKey.WithHeader(headers),
+	)
 
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	defer response.Body.Close()
+	defer closeResponse(response)
+
+	if response.IsError() && response.StatusCode != http.StatusNotFound {
+		return responseDiagnostics(response, "Failed to invalidate API key", nil)
+	}
+
+	return diags
+}
+
+// readAPIKey requests an API key by its ID. It returns nil when the key does
+// not exist. API keys are not cached like users and roles, as clusters keep
+// invalidated and expired keys for a while and listing them all is costly.
+func (p *providerState) readAPIKey(ctx context.Context, id string, headers map[string]string) (*apiKeyCreateResponse, diag.Diagnostics) {
+	client := p.client
+
+	response, err := client.Security.GetAPIKey(
+		client.Security.GetAPIKey.WithID(id),
+		client.Security.GetAPIKey.WithContext(ctx),
+		client.Security.GetAPIKey.WithHeader(headers),
+	)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	defer closeResponse(response)
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
 
 	if response.IsError() {
-		return diag.Errorf("Failed to invalidate API key: [%d] %s", response.StatusCode, response.String())
+		return nil, responseDiagnostics(response, "Failed to read API key", nil)
 	}
 
-	io.Copy(ioutil.Discard, response.Body)
+	var getResponse apiKeyGetResponse
+	if err := json.NewDecoder(response.Body).Decode(&getResponse); err != nil {
+		return nil, diag.FromErr(err)
+	}
 
-	return diags
+	for _, apiKey := range getResponse.APIKeys {
+		if apiKey.ID == id {
+			return &apiKey, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// isExpired reports whether an API key has expired. The expiration is in
+// milliseconds since the epoch, or zero when the key does not expire.
+func isExpired(apiKey apiKeyCreateResponse) bool {
+	return apiKey.Expiration != 0 && apiKey.Expiration <= time.Now().UnixNano()/int64(time.Millisecond)
 }
 
 func mapRole(item interface{}) (string, roleModel) {
@@ -0,0 +1,140 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// reservedUsers are the built-in users of Elasticsearch. They cannot be
+// created or deleted, only their password and enabled state can be changed.
+var reservedUsers = []string{
+	"apm_system",
+	"beats_system",
+	"elastic",
+	"kibana",
+	"kibana_system",
+	"logstash_system",
+	"remote_monitoring_user",
+}
+
+func resourceBuiltinUserPassword() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceBuiltinUserPasswordCreateOrUpdate,
+		ReadContext:   resourceBuiltinUserPasswordRead,
+		UpdateContext: resourceBuiltinUserPasswordCreateOrUpdate,
+		DeleteContext: resourceBuiltinUserPasswordDelete,
+		CustomizeDiff: resourceBuiltinUserPasswordCustomizeDiff,
+		Schema:        builtinUserPasswordResource.Schema,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(defaultTimeout),
+			Read:   schema.DefaultTimeout(defaultTimeout),
+			Update: schema.DefaultTimeout(defaultTimeout),
+			Delete: schema.DefaultTimeout(defaultTimeout),
+		},
+	}
+}
+
+func resourceBuiltinUserPasswordCustomizeDiff(context context.Context, diff *schema.ResourceDiff, state interface{}) error {
+	provider := state.(*providerState)
+
+	if err := provider.requireSecurity(context); err != nil {
+		return err
+	}
+
+	if openSearch, err := provider.plannedOpenSearch(context); err == nil && openSearch {
+		return fmt.Errorf("elasticsearch_builtin_user_password is not supported by OpenSearch, whose reserved users are managed with elasticsearch_user")
+	}
+
+	return nil
+}
+
+func resourceBuiltinUserPasswordCreateOrUpdate(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
+	provider := state.(*providerState)
+
+	operation := operationUpdate
+	if data.IsNewResource() {
+		operation = operationCreate
+	}
+	headers := provider.requestHeaders(data, "elasticsearch_builtin_user_password", operation)
+
+	username := data.Get(usernameKey).(string)
+
+	if data.IsNewResource() || data.HasChange(enabledKey) {
+		if diags := setUserEnabled(context, provider, username, data.Get(enabledKey).(bool), headers); diags.HasError() {
+			return diags
+		}
+	}
+
+	// The password is changed last, as the provider can no longer
+	// authenticate once the password of its own user changed.
+	passwordChanged := data.IsNewResource() || data.HasChange(passwordKey)
+	if passwordChanged {
+		password := passwordModel{
+			Password: data.Get(passwordKey).(string),
+		}
+		if diags := changePassword(context, provider, username, password, headers); diags.HasError() {
+			return diags
+		}
+	}
+
+	provider.cache.invalidate(usersCache, username)
+
+	data.SetId(username)
+
+	if passwordChanged && username == provider.username {
+		log.Printf("[WARN] Changed the password of %s, which the provider authenticates as, not reading the user back", username)
+		return nil
+	}
+
+	return resourceBuiltinUserPasswordRead(context, data, state)
+}
+
+func resourceBuiltinUserPasswordRead(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
+	provider := state.(*providerState)
+
+	username := data.Id()
+	headers := provider.requestHeaders(data, "elasticsearch_builtin_user_password", operationRead)
+
+	object, diags := provider.cache.read(context, usersCache, username, headers, provider.batchHeaders(headers), provider.readUsers)
+	if diags.HasError() {
+		return diags
+	}
+
+	user, exists := object.(userModel)
+
+	if !exists {
+		log.Printf("[WARN] User %s not found, removing it from state", username)
+		data.SetId("")
+		return nil
+	}
+
+	var err error
+
+	if err == nil {
+		err = data.Set(usernameKey, user.Username)
+	}
+
+	if err == nil {
+		err = data.Set(enabledKey, user.Enabled)
+	}
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diags
+}
+
+// resourceBuiltinUserPasswordDelete leaves the user in place, as reserved
+// users cannot be deleted. Its password is not reset either.
+func resourceBuiltinUserPasswordDelete(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
+	log.Printf("[INFO] Removing the password of reserved user %s from state, the user is left in place", data.Id())
+
+	var diags diag.Diagnostics
+
+	return diags
+}
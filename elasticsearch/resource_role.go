@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"io"
-	"io/ioutil"
+	"log"
+	"net/http"
 
-	api "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -18,12 +19,79 @@ func resourceRole() *schema.Resource {
 		ReadContext:   resourceRoleRead,
 		UpdateContext: resourceRoleCreateOrUpdate,
 		DeleteContext: resourceRoleDelete,
-		Schema:        roleResource.Schema,
+		CustomizeDiff: resourceRoleCustomizeDiff,
+		Schema:        roleResourceSchema(),
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(defaultTimeout),
+			Read:   schema.DefaultTimeout(defaultTimeout),
+			Update: schema.DefaultTimeout(defaultTimeout),
+			Delete: schema.DefaultTimeout(defaultTimeout),
+		},
 	}
 }
 
+func resourceRoleCustomizeDiff(context context.Context, diff *schema.ResourceDiff, state interface{}) error {
+	provider := state.(*providerState)
+
+	if err := provider.requireSecurity(context); err != nil {
+		return err
+	}
+
+	if openSearch, err := provider.plannedOpenSearch(context); err == nil && openSearch {
+		role := roleModel{
+			Applications: mapApplications(diff.Get(applicationsKey).([]interface{})),
+			Indices:      mapIndices(diff.Get(indicesKey).([]interface{})),
+			RunAs:        mapStringArray(diff.Get(runAsKey).([]interface{})),
+			Metadata:     mapStringMap(diff.Get(metadataKey).(map[string]interface{})),
+		}
+		return checkOpenSearchRole(role)
+	}
+
+	return checkRoleFeatures(context, provider, diff.Get(indicesKey).([]interface{}), diff.Get(applicationsKey).([]interface{}))
+}
+
+// checkRoleFeatures verifies that the cluster supports the privileges of a role.
+func checkRoleFeatures(context context.Context, provider *providerState, indices []interface{}, applications []interface{}) error {
+	if len(applications) > 0 {
+		if err := provider.requireVersion(context, applicationPrivilegesVersion, "Application privileges"); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range mapIndices(indices) {
+		if index.AllowUnRestrictedIndices {
+			if err := provider.requireVersion(context, allowRestrictedIndicesVersion, allowUnRestrictedIndicesKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// roleLicenseWarnings warns about the privileges of roles that the license of
+// the cluster does not include.
+func roleLicenseWarnings(context context.Context, provider *providerState, roles []roleModel) diag.Diagnostics {
+	for _, role := range roles {
+		for _, index := range role.Indices {
+			if index.Query != "" || len(index.FieldSecurity.Grant) > 0 {
+				return provider.licenseWarning(context, "Document and field level security", "platinum", "enterprise", "trial")
+			}
+		}
+	}
+
+	return nil
+}
+
 func resourceRoleCreateOrUpdate(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
+	provider := state.(*providerState)
+	client := provider.client
+
+	operation := operationUpdate
+	if data.IsNewResource() {
+		operation = operationCreate
+	}
+	headers := provider.requestHeaders(data, "elasticsearch_role", operation)
 
 	roleName := data.Get(nameKey).(string)
 	role := roleModel{
@@ -40,61 +108,63 @@ func resourceRoleCreateOrUpdate(context context.Context, data *schema.ResourceDa
 		role.RunAs = mapStringArray(runAs.([]interface{}))
 	}
 
-	var buffer bytes.Buffer
-	if err := json.NewEncoder(&buffer).Encode(role); err != nil {
+	openSearch, err := provider.isOpenSearch(context)
+	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	response, err := client.Security.PutRole(roleName, &buffer)
+	var response *esapi.Response
+	if openSearch {
+		response, err = provider.putOpenSearchRole(context, roleName, role, headers)
+	} else {
+		var buffer bytes.Buffer
+		if err := json.NewEncoder(&buffer).Encode(role); err != nil {
+			return diag.FromErr(err)
+		}
+
+		response, err = client.Security.PutRole(roleName, &buffer,
+			client.Security.PutRole.WithContext(context),
+			client.Security.PutRole.WithHeader(headers),
+		)
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	defer response.Body.Close()
+	defer closeResponse(response)
 
 	if response.IsError() {
-		return diag.Errorf("Failed to create role: [%d] %s", response.StatusCode, response.String())
+		return responseDiagnostics(response, "Failed to create role", roleErrorLocator(cty.Path{}, role))
 	}
 
-	// Empty the response body...
-	io.Copy(ioutil.Discard, response.Body)
+	provider.cache.invalidate(rolesCache, roleName)
 
 	data.SetId(roleName)
 
-	return resourceRoleRead(context, data, state)
+	diags := roleLicenseWarnings(context, provider, []roleModel{role})
+
+	return append(diags, resourceRoleRead(context, data, state)...)
 }
 
 func resourceRoleRead(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
-
-	var diags diag.Diagnostics
+	provider := state.(*providerState)
 
 	name := data.Id()
+	headers := provider.requestHeaders(data, "elasticsearch_role", operationRead)
 
-	response, err := client.Security.GetRole(client.Security.GetRole.WithName(name))
-
-	if err != nil {
-		return diag.FromErr(err)
-	}
-
-	defer response.Body.Close()
-
-	if response.IsError() {
-		return diag.Errorf("Failed to read role: [%d] %s", response.StatusCode, response.String())
+	object, diags := provider.cache.read(context, rolesCache, name, headers, provider.batchHeaders(headers), provider.readRoles)
+	if diags.HasError() {
+		return diags
 	}
 
-	var roleResponse map[string]roleModel
-
-	err = json.NewDecoder(response.Body).Decode(&roleResponse)
-
-	if err != nil {
-		return diag.FromErr(err)
-	}
+	var err error
 
-	role, exists := roleResponse[name]
+	role, exists := object.(roleModel)
 
 	if !exists {
-		return diag.Errorf("Role does not exist!")
+		log.Printf("[WARN] Role %s not found, removing it from state", name)
+		data.SetId("")
+		return nil
 	}
 
 	if err == nil {
@@ -125,29 +195,104 @@ func resourceRoleRead(context context.Context, data *schema.ResourceData, state
 }
 
 func resourceRoleDelete(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
+	provider := state.(*providerState)
+	client := provider.client
 
 	var diags diag.Diagnostics
 
 	name := data.Id()
+	headers := provider.requestHeaders(data, "elasticsearch_role", operationDelete)
 
-	response, err := client.Security.DeleteRole(name)
+	openSearch, err := provider.isOpenSearch(context)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var response *esapi.Response
+	if openSearch {
+		response, err = provider.perform(context, http.MethodDelete, openSearchRolePath(name), nil, headers)
+	} else {
+		response, err = client.Security.DeleteRole(name,
+			client.Security.DeleteRole.WithContext(context),
+			client.Security.DeleteRole.WithHeader(headers),
+		)
+	}
 
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	defer response.Body.Close()
+	defer closeResponse(response)
 
-	if response.IsError() {
-		return diag.Errorf("Failed to delete role: [%d] %s", response.StatusCode, response.String())
+	if response.IsError() && response.StatusCode != http.StatusNotFound {
+		return responseDiagnostics(response, "Failed to delete role", nil)
 	}
 
-	io.Copy(ioutil.Discard, response.Body)
+	provider.cache.invalidate(rolesCache, name)
 
 	return diags
 }
 
+// readRoles requests a role, or all roles when the name is empty.
+func (p *providerState) readRoles(ctx context.Context, name string, headers map[string]string) (map[string]interface{}, diag.Diagnostics) {
+	client := p.client
+
+	openSearch, err := p.isOpenSearch(ctx)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	var response *esapi.Response
+	if openSearch {
+		response, err = p.perform(ctx, http.MethodGet, openSearchRolePath(name), nil, headers)
+	} else {
+		options := []func(*esapi.SecurityGetRoleRequest){
+			client.Security.GetRole.WithContext(ctx),
+			client.Security.GetRole.WithHeader(headers),
+		}
+		if name != "" {
+			options = append(options, client.Security.GetRole.WithName(name))
+		}
+		response, err = client.Security.GetRole(options...)
+	}
+
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	defer closeResponse(response)
+
+	roles := map[string]interface{}{}
+
+	if response.StatusCode == http.StatusNotFound {
+		return roles, nil
+	}
+
+	if response.IsError() {
+		return nil, responseDiagnostics(response, "Failed to read role", nil)
+	}
+
+	if openSearch {
+		var openSearchRoles map[string]openSearchRoleModel
+		if err := json.NewDecoder(response.Body).Decode(&openSearchRoles); err != nil {
+			return nil, diag.FromErr(err)
+		}
+		for roleName, role := range openSearchRoles {
+			roles[roleName] = fromOpenSearchRole(role)
+		}
+	} else {
+		var roleResponse map[string]roleModel
+		if err := json.NewDecoder(response.Body).Decode(&roleResponse); err != nil {
+			return nil, diag.FromErr(err)
+		}
+		for roleName, role := range roleResponse {
+			roles[roleName] = role
+		}
+	}
+
+	return roles, nil
+}
+
 func mapApplications(source []interface{}) []applicationModel {
 	var result []applicationModel
 	for _, item := range source {
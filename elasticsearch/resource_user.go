@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"io"
-	"io/ioutil"
-
-	api "github.com/elastic/go-elasticsearch/v7"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
 
+	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -19,12 +20,66 @@ func resourceUser() *schema.Resource {
 		ReadContext:   resourceUserRead,
 		UpdateContext: resourceUserCreateOrUpdate,
 		DeleteContext: resourceUserDelete,
-		Schema:        userResource.Schema,
+		CustomizeDiff: resourceUserCustomizeDiff,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceUserImport,
+		},
+		Schema: userResource.Schema,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(defaultTimeout),
+			Read:   schema.DefaultTimeout(defaultTimeout),
+			Update: schema.DefaultTimeout(defaultTimeout),
+			Delete: schema.DefaultTimeout(defaultTimeout),
+		},
+	}
+}
+
+func resourceUserCustomizeDiff(context context.Context, diff *schema.ResourceDiff, state interface{}) error {
+	provider := state.(*providerState)
+
+	if err := provider.requireSecurity(context); err != nil {
+		return err
+	}
+
+	if openSearch, err := provider.plannedOpenSearch(context); err == nil && openSearch {
+		_, err := toOpenSearchUser(userModel{
+			Email:   diff.Get(emailKey).(string),
+			Enabled: diff.Get(enabledKey).(bool),
+		})
+		if err != nil {
+			return err
+		}
 	}
+
+	return nil
+}
+
+// resourceUserImport sets the attributes that are not read back to their
+// defaults, so that the first plan after an import does not update them.
+// importedPassword marks the password of an imported user, which is not
+// known until the first apply records the configured one.
+const importedPassword = "<imported>"
+
+func resourceUserImport(context context.Context, data *schema.ResourceData, state interface{}) ([]*schema.ResourceData, error) {
+	if err := data.Set(passwordInitialOnlyKey, false); err != nil {
+		return nil, err
+	}
+
+	if err := data.Set(passwordKey, importedPassword); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{data}, nil
 }
 
 func resourceUserCreateOrUpdate(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
+	provider := state.(*providerState)
+
+	operation := operationUpdate
+	if data.IsNewResource() {
+		operation = operationCreate
+	}
+	headers := provider.requestHeaders(data, "elasticsearch_user", operation)
 
 	user := userModel{
 		Username: data.Get(usernameKey).(string),
@@ -41,6 +96,14 @@ func resourceUserCreateOrUpdate(context context.Context, data *schema.ResourceDa
 		user.FullName = fullName.(string)
 	}
 
+	if passwordHash, exists := data.GetOk(passwordHashKey); exists {
+		user.PasswordHash = passwordHash.(string)
+	}
+
+	if data.IsNewResource() && user.Password == "" && user.PasswordHash == "" {
+		return diag.Errorf("%s or %s is required to create a user", passwordKey, passwordHashKey)
+	}
+
 	if roles, exists := data.GetOk(rolesKey); exists {
 		user.Roles = mapStringArray(roles.([]interface{}))
 	}
@@ -49,74 +112,193 @@ func resourceUserCreateOrUpdate(context context.Context, data *schema.ResourceDa
 		user.Metadata = mapStringMap(metadata.(map[string]interface{}))
 	}
 
-	var buffer bytes.Buffer
-	if err := json.NewEncoder(&buffer).Encode(user); err != nil {
+	openSearch, err := provider.isOpenSearch(context)
+	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	response, err := client.Security.PutUser(user.Username, &buffer)
-	if err != nil {
-		return diag.FromErr(err)
+	// Passwords are only sent when they change, so that updates do not reset
+	// the passwords of users. OpenSearch has no endpoint to change them.
+	password := passwordModel{
+		Password:     user.Password,
+		PasswordHash: user.PasswordHash,
+	}
+	// Removing the hash without setting a password keeps the password.
+	passwordChanged := !data.IsNewResource() && data.HasChanges(passwordKey, passwordHashKey) &&
+		(password.Password != "" || password.PasswordHash != "")
+
+	// The configured password of an imported user is only recorded, as the
+	// user may already have it. Later changes are applied.
+	if oldPassword, _ := data.GetChange(passwordKey); oldPassword.(string) == importedPassword {
+		if passwordChanged {
+			log.Printf("[INFO] Recording the password of imported user %s without changing it", user.Username)
+		}
+		passwordChanged = false
 	}
 
-	defer response.Body.Close()
+	if !data.IsNewResource() && !(openSearch && passwordChanged) {
+		user.Password = ""
+		user.PasswordHash = ""
+	}
 
-	if response.IsError() {
-		return diag.Errorf("Failed to create user: [%d] %s", response.StatusCode, response.String())
+	if openSearch || data.IsNewResource() || data.HasChanges(emailKey, fullNameKey, rolesKey, metadataKey) {
+		if diags := putUser(context, provider, user, openSearch, headers); diags.HasError() {
+			return diags
+		}
 	}
 
-	// Empty the response body...
-	io.Copy(ioutil.Discard, response.Body)
+	if !openSearch && !data.IsNewResource() && data.HasChange(enabledKey) {
+		if diags := setUserEnabled(context, provider, user.Username, user.Enabled, headers); diags.HasError() {
+			return diags
+		}
+	}
+
+	if !openSearch && passwordChanged {
+		if diags := changePassword(context, provider, user.Username, password, headers); diags.HasError() {
+			return diags
+		}
+	}
+
+	provider.cache.invalidate(usersCache, user.Username)
 
 	data.SetId(user.Username)
 
 	return resourceUserRead(context, data, state)
 }
 
-func resourceUserRead(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
+func putUser(context context.Context, provider *providerState, user userModel, openSearch bool, headers map[string]string) diag.Diagnostics {
+	client := provider.client
+
+	var response *esapi.Response
+	var err error
+	if openSearch {
+		response, err = provider.putOpenSearchUser(context, user, headers)
+	} else {
+		var buffer bytes.Buffer
+		if err := json.NewEncoder(&buffer).Encode(user); err != nil {
+			return diag.FromErr(err)
+		}
 
-	var diags diag.Diagnostics
+		response, err = client.Security.PutUser(user.Username, &buffer,
+			client.Security.PutUser.WithContext(context),
+			client.Security.PutUser.WithHeader(headers),
+		)
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	username := data.Id()
+	defer closeResponse(response)
+
+	if response.IsError() {
+		return responseDiagnostics(response, "Failed to create user", userErrorLocator)
+	}
+
+	return nil
+}
 
-	response, err := client.Security.GetUser(client.Security.GetUser.WithUsername(username))
+func changePassword(context context.Context, provider *providerState, username string, password passwordModel, headers map[string]string) diag.Diagnostics {
+	client := provider.client
+
+	var buffer bytes.Buffer
+	if err := json.NewEncoder(&buffer).Encode(password); err != nil {
+		return diag.FromErr(err)
+	}
+
+	response, err := client.Security.ChangePassword(&buffer,
+		client.Security.ChangePassword.WithUsername(username),
+		client.Security.ChangePassword.WithContext(context),
+		client.Security.ChangePassword.WithHeader(headers),
+	)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	defer response.Body.Close()
+	defer closeResponse(response)
 
-	var usersResponse map[string]userModel
+	if response.IsError() {
+		return responseDiagnostics(response, "Failed to change password", userErrorLocator)
+	}
 
-	err = json.NewDecoder(response.Body).Decode(&usersResponse)
+	return nil
+}
 
+// setUserEnabled enables or disables a user without changing anything else.
+func setUserEnabled(context context.Context, provider *providerState, username string, enabled bool, headers map[string]string) diag.Diagnostics {
+	client := provider.client
+
+	var response *esapi.Response
+	var err error
+	if enabled {
+		response, err = client.Security.EnableUser(username,
+			client.Security.EnableUser.WithContext(context),
+			client.Security.EnableUser.WithHeader(headers),
+		)
+	} else {
+		response, err = client.Security.DisableUser(username,
+			client.Security.DisableUser.WithContext(context),
+			client.Security.DisableUser.WithHeader(headers),
+		)
+	}
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	user, exists := usersResponse[username]
+	defer closeResponse(response)
 
-	if exists {
-		if err == nil {
-			err = data.Set(usernameKey, user.Username)
+	if response.IsError() {
+		if enabled {
+			return responseDiagnostics(response, "Failed to enable user", nil)
 		}
+		return responseDiagnostics(response, "Failed to disable user", nil)
+	}
 
-		if err == nil {
-			err = data.Set(enabledKey, user.Enabled)
-		}
+	return nil
+}
 
-		if err == nil {
-			err = data.Set(fullNameKey, user.FullName)
-		}
+func resourceUserRead(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
+	provider := state.(*providerState)
 
-		if err == nil {
-			err = data.Set(rolesKey, user.Roles)
-		}
+	username := data.Id()
+	headers := provider.requestHeaders(data, "elasticsearch_user", operationRead)
 
-		if err == nil {
-			err = data.Set(metadataKey, user.Metadata)
-		}
+	object, diags := provider.cache.read(context, usersCache, username, headers, provider.batchHeaders(headers), provider.readUsers)
+	if diags.HasError() {
+		return diags
+	}
+
+	var err error
+
+	user, exists := object.(userModel)
+
+	if !exists {
+		log.Printf("[WARN] User %s not found, removing it from state", username)
+		data.SetId("")
+		return nil
+	}
+
+	if err == nil {
+		err = data.Set(usernameKey, user.Username)
+	}
+
+	if err == nil {
+		err = data.Set(emailKey, user.Email)
+	}
+
+	if err == nil {
+		err = data.Set(enabledKey, user.Enabled)
+	}
+
+	if err == nil {
+		err = data.Set(fullNameKey, user.FullName)
+	}
+
+	if err == nil {
+		err = data.Set(rolesKey, user.Roles)
+	}
+
+	if err == nil {
+		err = data.Set(metadataKey, user.Metadata)
 	}
 
 	if err != nil {
@@ -127,26 +309,120 @@ func resourceUserRead(context context.Context, data *schema.ResourceData, state
 }
 
 func resourceUserDelete(context context.Context, data *schema.ResourceData, state interface{}) diag.Diagnostics {
-	client := state.(*api.Client)
+	provider := state.(*providerState)
+	client := provider.client
 
 	var diags diag.Diagnostics
 
 	username := data.Id()
+	headers := provider.requestHeaders(data, "elasticsearch_user", operationDelete)
 
-	response, err := client.Security.DeleteUser(username)
+	openSearch, err := provider.isOpenSearch(context)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var response *esapi.Response
+	if openSearch {
+		response, err = provider.perform(context, http.MethodDelete, openSearchUserPath(username), nil, headers)
+	} else {
+		response, err = client.Security.DeleteUser(username,
+			client.Security.DeleteUser.WithContext(context),
+			client.Security.DeleteUser.WithHeader(headers),
+		)
+	}
 
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	defer response.Body.Close()
+	defer closeResponse(response)
 
-	if response.IsError() {
-		return diag.Errorf("Failed to delete user: [%d] %s", response.StatusCode, response.String())
+	if response.IsError() && response.StatusCode != http.StatusNotFound {
+		return responseDiagnostics(response, "Failed to delete user", nil)
 	}
 
-	// Empty the response body
-	io.Copy(ioutil.Discard, response.Body)
+	provider.cache.invalidate(usersCache, username)
 
 	return diags
 }
+
+// readUsers requests a user, or all users when the username is empty.
+func (p *providerState) readUsers(ctx context.Context, username string, headers map[string]string) (map[string]interface{}, diag.Diagnostics) {
+	client := p.client
+
+	openSearch, err := p.isOpenSearch(ctx)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	var response *esapi.Response
+	if openSearch {
+		response, err = p.perform(ctx, http.MethodGet, openSearchUserPath(username), nil, headers)
+	} else {
+		options := []func(*esapi.SecurityGetUserRequest){
+			client.Security.GetUser.WithContext(ctx),
+			client.Security.GetUser.WithHeader(headers),
+		}
+		if username != "" {
+			options = append(options, client.Security.GetUser.WithUsername(username))
+		}
+		response, err = client.Security.GetUser(options...)
+	}
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	defer closeResponse(response)
+
+	users := map[string]interface{}{}
+
+	// Unlike Elasticsearch, OpenSearch does not answer with a JSON object
+	// when the user does not exist.
+	if response.StatusCode == http.StatusNotFound {
+		return users, nil
+	}
+
+	if response.IsError() {
+		return nil, responseDiagnostics(response, "Failed to read user", nil)
+	}
+
+	if openSearch {
+		var openSearchUsers map[string]openSearchUserModel
+		if err := json.NewDecoder(response.Body).Decode(&openSearchUsers); err != nil {
+			return nil, diag.FromErr(err)
+		}
+		for name, user := range openSearchUsers {
+			users[name] = fromOpenSearchUser(name, user)
+		}
+	} else {
+		var usersResponse map[string]userModel
+		if err := json.NewDecoder(response.Body).Decode(&usersResponse); err != nil {
+			return nil, diag.FromErr(err)
+		}
+		for name, user := range usersResponse {
+			users[name] = user
+		}
+	}
+
+	return users, nil
+}
+
+// suppressPasswordChange ignores changes of the password of existing users
+// when it is only set on creation.
+func suppressPasswordChange(key string, old string, new string, data *schema.ResourceData) bool {
+	return data.Id() != "" && data.Get(passwordInitialOnlyKey).(bool)
+}
+
+// passwordHashPrefixes identify the password hashes that Elasticsearch
+// accepts: bcrypt and PBKDF2.
+var passwordHashPrefixes = []string{"$2a$", "$2b$", "$2y$", "{PBKDF2}", "{PBKDF2_STRETCH}"}
+
+func validatePasswordHash(value interface{}, key string) ([]string, []error) {
+	for _, prefix := range passwordHashPrefixes {
+		if strings.HasPrefix(value.(string), prefix) {
+			return nil, nil
+		}
+	}
+	return nil, []error{fmt.Errorf("%q is not a bcrypt or PBKDF2 hash, expected one of the prefixes %s", key, strings.Join(passwordHashPrefixes, ", "))}
+}
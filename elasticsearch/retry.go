@@ -0,0 +1,128 @@
+package elasticsearch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	api "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/elastic/go-elasticsearch/v7/estransport"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+var defaultRetryOnStatus = []int{429, 502, 503, 504}
+
+// configureRetries sets how the client retries failed requests. The client
+// counts attempts rather than retries, and retries network errors as well as
+// the configured response statuses.
+func configureRetries(data *schema.ResourceData, config *api.Config) error {
+	maxRetries := data.Get("max_retries").(int)
+
+	// The client fails over to other nodes by retrying network errors, so
+	// this also keeps requests on the node they were sent to first.
+	if maxRetries == 0 {
+		config.DisableRetry = true
+		return nil
+	}
+
+	minBackoff, err := time.ParseDuration(data.Get("retry_backoff_min").(string))
+	if err != nil {
+		return fmt.Errorf("invalid retry_backoff_min: %s", err)
+	}
+
+	maxBackoff, err := time.ParseDuration(data.Get("retry_backoff_max").(string))
+	if err != nil {
+		return fmt.Errorf("invalid retry_backoff_max: %s", err)
+	}
+
+	if maxBackoff < minBackoff {
+		return fmt.Errorf("retry_backoff_max must not be lower than retry_backoff_min")
+	}
+
+	config.RetryOnStatus = retryStatuses(data)
+
+	config.MaxRetries = maxRetries + 1
+	config.RetryBackoff = func(attempt int) time.Duration {
+		// The client also calls the backoff after the last attempt failed.
+		if attempt > maxRetries {
+			return 0
+		}
+
+		delay := backoff(attempt, minBackoff, maxBackoff)
+		log.Printf("[WARN] Elasticsearch request failed, retrying in %s (retry %d of %d)", delay, attempt, maxRetries)
+		return delay
+	}
+
+	return nil
+}
+
+// retryStatuses returns the response statuses that the client retries, or
+// nil when retries are disabled.
+func retryStatuses(data *schema.ResourceData) []int {
+	if data.Get("max_retries").(int) == 0 {
+		return nil
+	}
+
+	if statuses := data.Get("retry_on_status").([]interface{}); len(statuses) > 0 {
+		return mapIntArray(statuses)
+	}
+
+	return defaultRetryOnStatus
+}
+
+// keepUnretriedResponses makes the client return the responses that
+// failoverTransport kept from being retried.
+func keepUnretriedResponses(client *api.Client) {
+	client.Transport = &unretriedTransport{next: client.Transport}
+	client.API = esapi.New(client.Transport)
+}
+
+// unretriedResponse is returned as an error for a response that the client
+// must not retry. The client retries responses by their status, for every
+// method, but not errors it does not recognise.
+type unretriedResponse struct {
+	response *http.Response
+}
+
+func (e *unretriedResponse) Error() string {
+	return fmt.Sprintf("unretried response: %s", e.response.Status)
+}
+
+type unretriedTransport struct {
+	next estransport.Interface
+}
+
+func (t *unretriedTransport) Perform(request *http.Request) (*http.Response, error) {
+	response, err := t.next.Perform(request)
+
+	var unretried *unretriedResponse
+	if errors.As(err, &unretried) {
+		return unretried.response, nil
+	}
+
+	return response, err
+}
+
+// backoff returns an exponentially growing delay with jitter, keeping at
+// least half of the computed delay.
+func backoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	delay := min
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	if delay <= 1 {
+		return delay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)))
+}
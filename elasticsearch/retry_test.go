@@ -0,0 +1,69 @@
+package elasticsearch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/elastic/go-elasticsearch/v7"
+)
+
+func TestStatusRetries(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(api.Config{
+		Addresses:     []string{server.URL},
+		Transport:     &failoverTransport{next: http.DefaultTransport, retryOnStatus: defaultRetryOnStatus},
+		RetryOnStatus: defaultRetryOnStatus,
+		MaxRetries:    3,
+		RetryBackoff:  func(attempt int) time.Duration { return 0 },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keepUnretriedResponses(client)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		attempts int32
+	}{
+		{name: "idempotent", method: http.MethodGet, path: "/_security/user", attempts: 3},
+		{name: "API key creation", method: http.MethodPut, path: "/_security/api_key", attempts: 1},
+		{name: "POST", method: http.MethodPost, path: "/_security/user/bob/_password", attempts: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			atomic.StoreInt32(&attempts, 0)
+
+			request, err := http.NewRequest(test.method, test.path, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, err := client.Transport.Perform(request)
+			if err != nil {
+				t.Fatalf("expected the response to be returned, got %s", err)
+			}
+			closeHTTPResponse(response)
+
+			if response.StatusCode != http.StatusBadGateway {
+				t.Errorf("expected status %d, got %d", http.StatusBadGateway, response.StatusCode)
+			}
+			if actual := atomic.LoadInt32(&attempts); actual != test.attempts {
+				t.Errorf("expected %d attempts, got %d", test.attempts, actual)
+			}
+		})
+	}
+}
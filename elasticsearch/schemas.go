@@ -1,9 +1,15 @@
 package elasticsearch
 
 import (
+	"time"
+
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
+// defaultTimeout is the default of the timeouts of every resource operation.
+const defaultTimeout = 5 * time.Minute
+
 var metadataSchema = schema.Schema{
 	Type:        schema.TypeMap,
 	Optional:    true,
@@ -13,6 +19,12 @@ var metadataSchema = schema.Schema{
 	},
 }
 
+var runAsUserSchema = schema.Schema{
+	Type:        schema.TypeString,
+	Optional:    true,
+	Description: "The user the requests for this resource are run as. Overrides the run_as setting of the provider.",
+}
+
 var userResource = schema.Resource{
 	Schema: map[string]*schema.Schema{
 		usernameKey: {
@@ -22,10 +34,26 @@ var userResource = schema.Resource{
 			Description: "An identifier for the user.",
 		},
 		passwordKey: {
-			Type:        schema.TypeString,
-			Required:    true,
-			Sensitive:   true,
-			Description: "The user’s password. Passwords must be at least 6 characters long.",
+			Type:             schema.TypeString,
+			Optional:         true,
+			Sensitive:        true,
+			DiffSuppressFunc: suppressPasswordChange,
+			Description:      "The user’s password. Passwords must be at least 6 characters long. Required to create a user, unless password_hash is set. The password of an imported user is not known, so the first apply after the import records the configured password without changing it. Later changes are applied.",
+		},
+		passwordHashKey: {
+			Type:             schema.TypeString,
+			Optional:         true,
+			Sensitive:        true,
+			ConflictsWith:    []string{passwordKey},
+			ValidateFunc:     validatePasswordHash,
+			DiffSuppressFunc: suppressPasswordChange,
+			Description:      "The hash of the user’s password, in a bcrypt or PBKDF2 format that matches the password hashing algorithm of the cluster.",
+		},
+		passwordInitialOnlyKey: {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+			Description: "Only sets the password when the user is created, so that users can change their password themselves.",
 		},
 		emailKey: {
 			Type:        schema.TypeString,
@@ -52,7 +80,8 @@ var userResource = schema.Resource{
 				Type: schema.TypeString,
 			},
 		},
-		metadataKey: &metadataSchema,
+		metadataKey:  &metadataSchema,
+		runAsUserKey: &runAsUserSchema,
 	},
 }
 
@@ -185,6 +214,43 @@ var roleResource = schema.Resource{
 	},
 }
 
+var builtinUserPasswordResource = schema.Resource{
+	Schema: map[string]*schema.Schema{
+		usernameKey: {
+			Type:         schema.TypeString,
+			Required:     true,
+			ForceNew:     true,
+			ValidateFunc: validation.StringInSlice(reservedUsers, false),
+			Description:  "The reserved user whose password is set, such as elastic or kibana_system.",
+		},
+		passwordKey: {
+			Type:        schema.TypeString,
+			Required:    true,
+			Sensitive:   true,
+			Description: "The user’s password. Passwords must be at least 6 characters long. When the provider authenticates as this user, its password setting must be updated before the next run.",
+		},
+		enabledKey: {
+			Type:        schema.TypeBool,
+			Default:     true,
+			Optional:    true,
+			Description: "Specifies whether the user is enabled.",
+		},
+		runAsUserKey: &runAsUserSchema,
+	},
+}
+
+// roleResourceSchema extends the role, which is also used for the role
+// descriptors of API keys, with the settings of the role resource.
+func roleResourceSchema() map[string]*schema.Schema {
+	result := map[string]*schema.Schema{
+		runAsUserKey: &runAsUserSchema,
+	}
+	for key, value := range roleResource.Schema {
+		result[key] = value
+	}
+	return result
+}
+
 var apiKeyResource = schema.Resource{
 	Schema: map[string]*schema.Schema{
 		nameKey: {
@@ -203,6 +269,21 @@ var apiKeyResource = schema.Resource{
 			Type:     schema.TypeString,
 			Computed: true,
 		},
+		metadataKey: {
+			Type:     schema.TypeMap,
+			Optional: true,
+			ForceNew: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Description: "Arbitrary metadata that you want to associate with the API key. Requires Elasticsearch 7.13 or later.",
+		},
+		runAsUserKey: {
+			Type:        schema.TypeString,
+			Optional:    true,
+			ForceNew:    true,
+			Description: "The user that owns the API key. Overrides the run_as setting of the provider.",
+		},
 		roleDescriptorsKey: {
 			Type:     schema.TypeList,
 			Optional: true,
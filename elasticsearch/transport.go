@@ -0,0 +1,255 @@
+package elasticsearch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// newTransport builds the HTTP transport used by the Elasticsearch client
+// from the provider configuration.
+func newTransport(data *schema.ResourceData) (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := newTLSConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if proxy := data.Get("proxy_url").(string); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %s", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	roundTripper, err := newAWSSigningTransport(data, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix := data.Get("opaque_id_prefix").(string); prefix != "" {
+		roundTripper = &opaqueIDTransport{next: roundTripper, id: prefix + ":provider"}
+	}
+
+	if timeout := data.Get("request_timeout").(string); timeout != "" {
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request_timeout: %s", err)
+		}
+		roundTripper = &timeoutTransport{next: roundTripper, timeout: duration}
+	}
+
+	limited := newLimitTransport(
+		&failoverTransport{next: roundTripper, retryOnStatus: retryStatuses(data)},
+		data.Get("max_concurrent_requests").(int),
+		data.Get("requests_per_second").(float64),
+	)
+
+	return limited, nil
+}
+
+// timeoutTransport limits the time each attempt of a request may take,
+// including reading the response body.
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(request.Context(), t.timeout)
+
+	response, err := t.next.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelOnClose releases the context of a request once its response is read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// opaqueIDTransport tags the requests that are not made by a resource, such
+// as the connection checks of the provider, with an X-Opaque-Id.
+type opaqueIDTransport struct {
+	next http.RoundTripper
+	id   string
+}
+
+func (t *opaqueIDTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Header.Get(opaqueIDHeader) == "" {
+		request = request.Clone(request.Context())
+		request.Header.Set(opaqueIDHeader, t.id)
+	}
+	return t.next.RoundTrip(request)
+}
+
+// failoverTransport keeps the client from retrying a request on another node
+// when the request is not idempotent and may already have reached the cluster.
+// The client retries network errors only, so those are wrapped into an error
+// that it does not recognise. Responses with a status that the client retries
+// are wrapped into an unretriedResponse, which unretriedTransport returns.
+type failoverTransport struct {
+	next          http.RoundTripper
+	retryOnStatus []int
+}
+
+func (t *failoverTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	if err == nil && !isIdempotent(request) {
+		for _, status := range t.retryOnStatus {
+			if response.StatusCode == status {
+				return nil, &unretriedResponse{response: response}
+			}
+		}
+	}
+
+	if err != nil {
+		if !isIdempotent(request) && !isDialError(err) {
+			return nil, &nonRetryableError{err: err}
+		}
+
+		// A reset connection is not always reported as a network error.
+		if isConnectionReset(err) {
+			return nil, &retryableError{err: err}
+		}
+	}
+	return response, err
+}
+
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *nonRetryableError) Unwrap() error {
+	return e.err
+}
+
+// retryableError marks an error as a temporary network error, which the client retries.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func (e *retryableError) Timeout() bool {
+	return false
+}
+
+func (e *retryableError) Temporary() bool {
+	return true
+}
+
+// isIdempotent reports whether sending the request twice has the same effect
+// as sending it once. Creating an API key uses PUT but is not idempotent.
+func isIdempotent(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		return true
+	case http.MethodPut:
+		return !strings.HasSuffix(strings.TrimSuffix(request.URL.Path, "/"), "/_security/api_key")
+	default:
+		return false
+	}
+}
+
+// isDialError reports whether the request failed before reaching the node.
+func isDialError(err error) bool {
+	var opError *net.OpError
+	return errors.As(err, &opError) && opError.Op == "dial"
+}
+
+func newTLSConfig(data *schema.ResourceData) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: data.Get("insecure").(bool),
+	}
+
+	caCert, err := readPEM(data, "ca_file", "ca_pem")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(caCert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no valid certificate found in the configured certificate authority")
+		}
+		config.RootCAs = pool
+	}
+
+	clientCert, err := readPEM(data, "client_cert_file", "client_cert_pem")
+	if err != nil {
+		return nil, err
+	}
+
+	clientKey, err := readPEM(data, "client_key_file", "client_key_pem")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clientCert) > 0 || len(clientKey) > 0 {
+		if len(clientCert) == 0 || len(clientKey) == 0 {
+			return nil, fmt.Errorf("a client certificate and a client key must be configured together")
+		}
+
+		certificate, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// readPEM returns the PEM content configured either as a file path or inline.
+func readPEM(data *schema.ResourceData, fileKey string, pemKey string) ([]byte, error) {
+	if path := data.Get(fileKey).(string); path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", fileKey, err)
+		}
+		return content, nil
+	}
+
+	return []byte(data.Get(pemKey).(string)), nil
+}
+
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
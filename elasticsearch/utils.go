@@ -16,3 +16,11 @@ func mapStringMap(source map[string]interface{}) map[string]string {
 	}
 	return result
 }
+
+func mapIntArray(source []interface{}) []int {
+	result := []int{}
+	for _, item := range source {
+		result = append(result, item.(int))
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Versions that introduced features used by the resources.
+var (
+	applicationPrivilegesVersion  = mustParseVersion("6.4.0")
+	apiKeysVersion                = mustParseVersion("6.7.0")
+	allowRestrictedIndicesVersion = mustParseVersion("6.7.0")
+	apiKeyMetadataVersion         = mustParseVersion("7.13.0")
+)
+
+// version is the version number of an Elasticsearch cluster.
+type version struct {
+	major int
+	minor int
+	patch int
+}
+
+// parseVersion parses versions such as `7.9.3` or `8.0.0-SNAPSHOT`.
+func parseVersion(source string) (version, error) {
+	number := strings.SplitN(source, "-", 2)[0]
+	parts := strings.Split(number, ".")
+	if len(parts) != 3 {
+		return version{}, fmt.Errorf("invalid version %q", source)
+	}
+
+	var values [3]int
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return version{}, fmt.Errorf("invalid version %q", source)
+		}
+		values[i] = value
+	}
+
+	return version{major: values[0], minor: values[1], patch: values[2]}, nil
+}
+
+func mustParseVersion(source string) version {
+	v, err := parseVersion(source)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (v version) atLeast(other version) bool {
+	if v.major != other.major {
+		return v.major > other.major
+	}
+	if v.minor != other.minor {
+		return v.minor > other.minor
+	}
+	return v.patch >= other.patch
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
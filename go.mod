@@ -3,6 +3,9 @@ module terraform-provider-elasticsearch
 go 1.15
 
 require (
+	github.com/aws/aws-sdk-go v1.35.23
 	github.com/elastic/go-elasticsearch/v7 v7.9.0
+	github.com/hashicorp/go-cty v1.4.1-0.20200414143053-d3edf31b6320
 	github.com/hashicorp/terraform-plugin-sdk/v2 v2.2.0
+	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e
 )